@@ -0,0 +1,772 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"thermostat/monitor"
+)
+
+func newLogger(level slog.Level, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level}
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts))
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, opts))
+}
+
+type logFlags struct {
+	level  *string
+	format *string
+}
+
+func addLogFlags(fs *flag.FlagSet) logFlags {
+	return logFlags{
+		level:  fs.String("log-level", "info", "log level: debug, info, warn or error"),
+		format: fs.String("log-format", "text", "log format: text or json"),
+	}
+}
+
+func (f logFlags) logger() *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*f.level)); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid -log-level %q\n", *f.level)
+		os.Exit(2)
+	}
+	if *f.format != "text" && *f.format != "json" {
+		fmt.Fprintf(os.Stderr, "invalid -log-format %q\n", *f.format)
+		os.Exit(2)
+	}
+	return newLogger(level, *f.format)
+}
+
+func listDevices(args []string) {
+	fs := flag.NewFlagSet("list-devices", flag.ExitOnError)
+	format := fs.String("format", "table", "output format: table or json")
+	configPath := fs.String("config", "config.json", "path to config file")
+	unit := fs.String("force-unit", "", "report all temperatures in F or C instead of each device's display unit")
+	logFlags := addLogFlags(fs)
+	fs.Parse(args)
+
+	logger := logFlags.logger()
+	if *format != "table" && *format != "json" {
+		logger.Error("unknown output format", "format", *format)
+		os.Exit(2)
+	}
+
+	cfg, err := monitor.LoadConfig(*configPath)
+	if err != nil {
+		logger.Error("failed to load config", "path", *configPath, "err", err)
+		os.Exit(1)
+	}
+	if err := forceUnit(cfg, *unit, logger); err != nil {
+		logger.Error("invalid flags", "err", err)
+		os.Exit(2)
+	}
+	m, err := monitor.New(cfg, nil, logger)
+	if err != nil {
+		logger.Error("failed to set up monitor", "err", err)
+		os.Exit(1)
+	}
+
+	summaries, err := m.ListDevices(context.Background())
+	if err != nil {
+		logger.Error("failed to list devices", "err", err)
+		os.Exit(1)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(summaries)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DEVICE ID\tALIAS\tMODEL\tMODE\tHVAC\tAMBIENT\tCONNECTIVITY")
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%.1f %s\t%s\n",
+			s.DeviceID, s.Alias, s.Model, s.Mode, s.HvacState, s.Ambient, unitSymbol(s.Unit), s.Connectivity)
+	}
+	w.Flush()
+}
+
+// resetDevice implements the reset-device subcommand, which deletes all of a
+// device's Redis state.
+func resetDevice(args []string) {
+	fs := flag.NewFlagSet("reset-device", flag.ExitOnError)
+	deviceID := fs.String("device", "", "ID of the device to reset")
+	yes := fs.Bool("yes", false, "don't ask for confirmation")
+	configPath := fs.String("config", "config.json", "path to config file")
+	logFlags := addLogFlags(fs)
+	fs.Parse(args)
+
+	logger := logFlags.logger()
+	if *deviceID == "" {
+		logger.Error("-device is required")
+		os.Exit(2)
+	}
+
+	cfg, err := monitor.LoadConfig(*configPath)
+	if err != nil {
+		logger.Error("failed to load config", "path", *configPath, "err", err)
+		os.Exit(1)
+	}
+
+	if !*yes {
+		fmt.Printf("Delete all Redis state for device %s? [y/N] ", *deviceID)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Println("Aborted.")
+			return
+		}
+	}
+
+	rdb := cfg.RedisClient()
+	m, err := monitor.New(cfg, rdb, logger)
+	if err != nil {
+		logger.Error("failed to set up monitor", "err", err)
+		os.Exit(1)
+	}
+	deleted, err := m.ResetDevice(context.Background(), *deviceID)
+	rdb.Close()
+	if err != nil {
+		logger.Error("failed to reset device", "device_id", *deviceID, "deleted", len(deleted), "err", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Deleted %d keys.\n", len(deleted))
+}
+
+// tailAlerts implements the tail-alerts subcommand, which prints alerts as
+// they are raised until interrupted.
+func tailAlerts(args []string) {
+	fs := flag.NewFlagSet("tail-alerts", flag.ExitOnError)
+	configPath := fs.String("config", "config.json", "path to config file")
+	deviceID := fs.String("device", "", "only show alerts for this device ID")
+	minPriority := fs.Int("min-priority", -2, "only show alerts of at least this Pushover priority (-2 to 2)")
+	logFlags := addLogFlags(fs)
+	fs.Parse(args)
+
+	logger := logFlags.logger()
+	cfg, err := monitor.LoadConfig(*configPath)
+	if err != nil {
+		logger.Error("failed to load config", "path", *configPath, "err", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	rdb := cfg.RedisClient()
+	defer rdb.Close()
+	m, err := monitor.New(cfg, rdb, logger)
+	if err != nil {
+		logger.Error("failed to set up monitor", "err", err)
+		os.Exit(1)
+	}
+
+	err = m.TailAlerts(ctx, func(e monitor.AlertEvent) {
+		if *deviceID != "" && e.DeviceID != *deviceID {
+			return
+		}
+		if p, err := strconv.Atoi(e.Priority); err == nil && p < *minPriority {
+			return
+		}
+		fmt.Printf("[%s] [%s] [%s] [%s] %s\n", e.Time.Format(time.RFC3339), e.DeviceID, e.Type, e.Priority, e.Message)
+	})
+	if err != nil && ctx.Err() == nil {
+		logger.Error("failed to tail alerts", "err", err)
+		os.Exit(1)
+	}
+}
+
+// rotateLog implements the rotate-log subcommand, which archives alert and
+// event logs from Redis to a file and trims them.
+func rotateLog(args []string) {
+	fs := flag.NewFlagSet("rotate-log", flag.ExitOnError)
+	configPath := fs.String("config", "config.json", "path to config file")
+	out := fs.String("out", "", "JSON lines file to append the archived entries to")
+	compress := fs.Bool("compress", false, "gzip the archived entries")
+	logFlags := addLogFlags(fs)
+	fs.Parse(args)
+
+	logger := logFlags.logger()
+	if *out == "" {
+		logger.Error("-out is required")
+		os.Exit(2)
+	}
+	cfg, err := monitor.LoadConfig(*configPath)
+	if err != nil {
+		logger.Error("failed to load config", "path", *configPath, "err", err)
+		os.Exit(1)
+	}
+
+	rdb := cfg.RedisClient()
+	m, err := monitor.New(cfg, rdb, logger)
+	if err != nil {
+		logger.Error("failed to set up monitor", "err", err)
+		os.Exit(1)
+	}
+	counts, err := m.RotateLogs(context.Background(), *out, *compress)
+	rdb.Close()
+	devices := make([]string, 0, len(counts))
+	for id := range counts {
+		devices = append(devices, id)
+	}
+	sort.Strings(devices)
+	for _, id := range devices {
+		fmt.Printf("%s: %d entries archived\n", id, counts[id])
+	}
+	if err != nil {
+		logger.Error("failed to rotate logs", "out", *out, "err", err)
+		os.Exit(1)
+	}
+}
+
+// writeReport implements the report subcommand, which writes a summary of the
+// last week to report_output_path and/or s3_bucket.
+func writeReport(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	configPath := fs.String("config", "config.json", "path to config file")
+	format := fs.String("format", "", "report format, json or text; overrides report_format")
+	output := fs.String("output", "", "file to write the report to; overrides report_output_path")
+	logFlags := addLogFlags(fs)
+	fs.Parse(args)
+
+	logger := logFlags.logger()
+	cfg, err := monitor.LoadConfig(*configPath)
+	if err != nil {
+		logger.Error("failed to load config", "path", *configPath, "err", err)
+		os.Exit(1)
+	}
+	if *format != "" {
+		cfg.ReportFormat = *format
+	}
+	if *output != "" {
+		cfg.ReportOutputPath = *output
+	}
+	if err := cfg.Validate(); err != nil {
+		logger.Error("invalid config", "path", *configPath, "err", err)
+		os.Exit(1)
+	}
+
+	rdb := cfg.RedisClient()
+	m, err := monitor.New(cfg, rdb, logger)
+	if err != nil {
+		logger.Error("failed to set up monitor", "err", err)
+		os.Exit(1)
+	}
+	err = m.WriteReport(context.Background())
+	rdb.Close()
+	if err != nil {
+		logger.Error("failed to write report", "err", err)
+		os.Exit(1)
+	}
+}
+
+// lockThermostat implements the lock-thermostat subcommand, which limits the
+// setpoints that can be chosen on the device itself.
+func lockThermostat(args []string) {
+	fs := flag.NewFlagSet("lock-thermostat", flag.ExitOnError)
+	deviceID := fs.String("device", "", "ID of the device to lock")
+	minTemp := fs.Float64("min-temp", 0, "lowest setpoint allowed, in °F")
+	maxTemp := fs.Float64("max-temp", 0, "highest setpoint allowed, in °F")
+	configPath := fs.String("config", "config.json", "path to config file")
+	logFlags := addLogFlags(fs)
+	fs.Parse(args)
+
+	logger := logFlags.logger()
+	if *deviceID == "" {
+		logger.Error("-device is required")
+		os.Exit(2)
+	}
+	m := commandMonitor(*configPath, logger)
+	minC, maxC := (*minTemp-32)*5/9, (*maxTemp-32)*5/9
+	if err := m.LockThermostat(monitor.WithOperator(context.Background(), "cli"), *deviceID, minC, maxC); err != nil {
+		logger.Error("failed to lock thermostat", "device_id", *deviceID, "err", err)
+		os.Exit(1)
+	}
+}
+
+// unlockThermostat implements the unlock-thermostat subcommand.
+func unlockThermostat(args []string) {
+	fs := flag.NewFlagSet("unlock-thermostat", flag.ExitOnError)
+	deviceID := fs.String("device", "", "ID of the device to unlock")
+	configPath := fs.String("config", "config.json", "path to config file")
+	logFlags := addLogFlags(fs)
+	fs.Parse(args)
+
+	logger := logFlags.logger()
+	if *deviceID == "" {
+		logger.Error("-device is required")
+		os.Exit(2)
+	}
+	m := commandMonitor(*configPath, logger)
+	if err := m.UnlockThermostat(monitor.WithOperator(context.Background(), "cli"), *deviceID); err != nil {
+		logger.Error("failed to unlock thermostat", "device_id", *deviceID, "err", err)
+		os.Exit(1)
+	}
+}
+
+// commandMonitor loads the config for a subcommand that talks to the SDM API
+// and alerts, but doesn't need Redis other than for a Redis audit log.
+func commandMonitor(configPath string, logger *slog.Logger) *monitor.Monitor {
+	cfg, err := monitor.LoadConfig(configPath)
+	if err != nil {
+		logger.Error("failed to load config", "path", configPath, "err", err)
+		os.Exit(1)
+	}
+	var rdb *redis.Client
+	if cfg.AuditEnabled && cfg.AuditBackend == "redis" {
+		rdb = cfg.RedisClient()
+	}
+	m, err := monitor.New(cfg, rdb, logger)
+	if err != nil {
+		logger.Error("failed to set up monitor", "err", err)
+		os.Exit(1)
+	}
+	return m
+}
+
+func unitSymbol(unit string) string {
+	if unit == "FAHRENHEIT" {
+		return "F"
+	}
+	return "C"
+}
+
+func watchSIGHUP(m *monitor.Monitor, path string, overrides func(*monitor.Config), logger *slog.Logger) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	for range sig {
+		changed, err := m.ReloadConfig(path, overrides)
+		if err != nil {
+			logger.Error("config reload rejected", "path", path, "err", err)
+			continue
+		}
+		logger.Info("config reloaded", "path", path, "changed", changed)
+	}
+}
+
+func sendTestDiscord(ctx context.Context, cfg *monitor.Config, logger *slog.Logger) {
+	if cfg.DiscordWebhookURL == "" {
+		logger.Error("discord_webhook_url must be set in config to use -test-discord")
+		os.Exit(1)
+	}
+	ambient := 21.5
+	n := &monitor.DiscordNotifier{WebhookURL: cfg.DiscordWebhookURL, Client: &http.Client{}}
+	err := n.Notify(ctx, monitor.AlertEvent{
+		Type:     "test",
+		DeviceID: "TEST",
+		Message:  "Test alert from nest-thermostat-monitor",
+		Priority: "0",
+		Time:     time.Now(),
+		Ambient:  &ambient,
+	})
+	if err != nil {
+		logger.Error("failed to send test alert", "notifier", n.Name(), "err", err)
+		os.Exit(1)
+	}
+	logger.Info("test alert sent", "notifier", n.Name())
+}
+
+// checkConfigFile implements -check-config: it lists every validation error
+// and warning, then tries the OAuth credentials if the config is valid.
+func checkConfigFile(ctx context.Context, cfg *monitor.Config, logger *slog.Logger) error {
+	errs := cfg.ValidationErrors()
+	warnings := cfg.Warnings()
+	for _, err := range errs {
+		fmt.Println("error:", err)
+	}
+	for _, w := range warnings {
+		fmt.Println("warning:", w)
+	}
+	if len(errs) > 0 {
+		fmt.Printf("Config invalid. %d validation errors, %d validation warnings.\n", len(errs), len(warnings))
+		return errs[0]
+	}
+
+	m, err := monitor.New(cfg, nil, logger)
+	if err != nil {
+		fmt.Println("error:", err)
+		return err
+	}
+	if err := m.CheckCredentials(ctx); err != nil {
+		fmt.Println("error: OAuth token fetch failed:", err)
+		fmt.Printf("Config valid. OAuth failed. %d validation warnings.\n", len(warnings))
+		return err
+	}
+	fmt.Printf("Config valid. OAuth OK. %d validation warnings.\n", len(warnings))
+	return nil
+}
+
+// showDeviceTraits prints a device's raw traits, or just the named one, as
+// indented JSON, for debugging trait parsing without calling the API by hand.
+func showDeviceTraits(ctx context.Context, cfg *monitor.Config, device, trait string, logger *slog.Logger) error {
+	if device == "" {
+		err := errors.New("-show-traits needs -device")
+		logger.Error("invalid flags", "err", err)
+		return err
+	}
+	m, err := monitor.New(cfg, nil, logger)
+	if err != nil {
+		logger.Error("failed to set up monitor", "err", err)
+		return err
+	}
+	traits, err := m.DeviceTraits(ctx, device)
+	if err != nil {
+		logger.Error("failed to fetch device traits", "device", device, "err", err)
+		return err
+	}
+	var v any = traits
+	if trait != "" {
+		raw, ok := traits[trait]
+		if !ok {
+			names := make([]string, 0, len(traits))
+			for name := range traits {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			err := fmt.Errorf("device %s has no trait %s", device, trait)
+			logger.Error("trait not found", "err", err, "traits", names)
+			return err
+		}
+		v = raw
+	}
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// serveHTTP serves the monitor's HTTP endpoints until the process exits.
+func serveHTTP(m *monitor.Monitor, addr string, logger *slog.Logger) {
+	logger.Info("serving HTTP", "addr", addr)
+	if err := http.ListenAndServe(addr, m.Handler()); err != nil {
+		logger.Error("HTTP server stopped", "addr", addr, "err", err)
+	}
+}
+
+// serveProfiles serves the pprof endpoints on their own address, for when
+// there's no -http-addr to add them to.
+func serveProfiles(m *monitor.Monitor, addr string, logger *slog.Logger) {
+	logger.Info("serving pprof", "addr", addr)
+	if err := http.ListenAndServe(addr, m.ProfileHandler()); err != nil {
+		logger.Error("pprof server stopped", "addr", addr, "err", err)
+	}
+}
+
+// serveGRPC serves the monitor's gRPC API until the process exits.
+func serveGRPC(m *monitor.Monitor, addr string, logger *slog.Logger) {
+	s, err := m.GRPCServer()
+	if err != nil {
+		logger.Error("failed to start gRPC server", "err", err)
+		return
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		logger.Error("failed to start gRPC server", "addr", addr, "err", err)
+		return
+	}
+	logger.Info("serving gRPC", "addr", addr)
+	if err := s.Serve(lis); err != nil {
+		logger.Error("gRPC server stopped", "addr", addr, "err", err)
+	}
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "list-devices":
+			listDevices(os.Args[2:])
+			return
+		case "reset-device":
+			resetDevice(os.Args[2:])
+			return
+		case "report":
+			writeReport(os.Args[2:])
+			return
+		case "lock-thermostat":
+			lockThermostat(os.Args[2:])
+			return
+		case "unlock-thermostat":
+			unlockThermostat(os.Args[2:])
+			return
+		case "tail-alerts":
+			tailAlerts(os.Args[2:])
+			return
+		case "rotate-log":
+			rotateLog(os.Args[2:])
+			return
+		}
+	}
+	if err := run(); err != nil {
+		// Failures have already been logged and alerted where they happened.
+		if errors.Is(err, monitor.ErrWatchdogExpired) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+// forceUnit applies the -force-unit flag, which overrides force_unit in the
+// config.
+func forceUnit(cfg *monitor.Config, unit string, logger *slog.Logger) error {
+	if unit != "" {
+		unit = strings.ToUpper(unit)
+		if unit != "F" && unit != "C" {
+			return fmt.Errorf("-force-unit must be F or C, got %q", unit)
+		}
+		cfg.ForceUnit = unit
+	}
+	if cfg.ForceUnit != "" {
+		logger.Info("all temperatures converted to forced unit", "unit", cfg.ForceUnit+" (forced)")
+	}
+	return nil
+}
+
+func countTrue(flags ...bool) int {
+	n := 0
+	for _, f := range flags {
+		if f {
+			n++
+		}
+	}
+	return n
+}
+
+// run runs the monitor in the mode selected by the command-line flags. It
+// returns rather than exiting so deferred cleanup always happens.
+func run() error {
+	configPath := flag.String("config", "config.json", "path to config file")
+	version := flag.Bool("version", false, "print version information and exit")
+	configSchema := flag.Bool("config-schema", false, "print the JSON Schema for the config file and exit")
+	oneShot := flag.Bool("one-shot", false, "poll all devices once and exit (the default)")
+	pubSubMode := flag.Bool("pubsub-mode", false, "receive device events from Cloud Pub/Sub instead of polling once")
+	pushMode := flag.Bool("push-mode", false, "receive device events from a Pub/Sub push subscription on -http-addr")
+	httpAddr := flag.String("http-addr", "", "serve /status, /chart, /metrics and /events/sdm on this address in -pubsub-mode or -push-mode, e.g. :8080")
+	grpcAddr := flag.String("grpc-addr", ":50051", "serve the gRPC API on this address in -pubsub-mode or -push-mode when grpc_cert_file is set; empty disables it")
+	profile := flag.Bool("profile", false, "serve Go pprof endpoints under /debug/pprof/ in -pubsub-mode or -push-mode, behind X-Admin-Token")
+	pprofAddr := flag.String("pprof-addr", "localhost:6060", "with -profile, serve the pprof endpoints on this address when -http-addr isn't set")
+	unit := flag.String("force-unit", "", "report all temperatures in F or C instead of each device's display unit")
+	migrateEncoding := flag.Bool("migrate-redis-encoding", false, "rewrite stored samples in redis_sample_encoding and exit")
+	simulate := flag.String("simulate-anomaly", "", "feed a synthetic cooling_rising or heating_falling trend through the alert pipeline and exit")
+	migrateV1 := flag.Bool("migrate-v1-to-v2", false, "copy sample lists to the namespaced key layout given by -redis-namespace and exit")
+	namespace := flag.String("redis-namespace", "", "namespace for -migrate-v1-to-v2, e.g. home1")
+	deleteOld := flag.Bool("delete-old", false, "with -migrate-v1-to-v2, delete each old key once it is copied")
+	backfill := flag.Bool("backfill", false, "re-derive active anomalies from stored samples before running")
+	snapshotPath := flag.String("export-prometheus-snapshot", "", "after each poll, write metrics to this file for node_exporter's textfile collector; overrides prometheus_snapshot_path")
+	checkConfig := flag.Bool("check-config", false, "validate the config and OAuth credentials and exit")
+	device := flag.String("device", "", "only process this device, given as its full name or short ID")
+	dryRun := flag.Bool("dry-run", false, "log alerts, thermostat commands and Redis writes instead of making them")
+	debugSamples := flag.Bool("debug-samples", false, "print a table of each device's sample to stdout after every poll")
+	testDiscord := flag.Bool("test-discord", false, "send a test alert to the configured Discord webhook and exit")
+	reprocess := flag.Bool("reprocess-last", false, "replay each device's stored samples through the anomaly checks, print what would have alerted and exit")
+	showTraits := flag.Bool("show-traits", false, "print the raw SDM traits of the device given by -device and exit")
+	trait := flag.String("trait", "", "with -show-traits, print only this trait, e.g. sdm.devices.traits.ThermostatHvac")
+	logFlags := addLogFlags(flag.CommandLine)
+	flag.Parse()
+
+	if *version {
+		fmt.Println(monitor.VersionString())
+		return nil
+	}
+	if *configSchema {
+		schema, err := monitor.ConfigSchema("monitor")
+		if err != nil {
+			logFlags.logger().Warn("field descriptions left out; run from the repository root to include them", "err", err)
+		}
+		if schema == nil {
+			return err
+		}
+		fmt.Println(string(schema))
+		return nil
+	}
+
+	ctx := context.Background()
+	logger := logFlags.logger()
+	if countTrue(*oneShot, *pubSubMode, *pushMode) > 1 {
+		err := errors.New("-one-shot, -pubsub-mode and -push-mode are mutually exclusive")
+		logger.Error("invalid flags", "err", err)
+		return err
+	}
+
+	cfg, err := monitor.LoadConfig(*configPath)
+	if err != nil {
+		logger.Error("failed to load config", "path", *configPath, "err", err)
+		return err
+	}
+	if err := forceUnit(cfg, *unit, logger); err != nil {
+		logger.Error("invalid flags", "err", err)
+		return err
+	}
+	// flagOverrides re-applies the flags that override config fields to a
+	// config reloaded on SIGHUP, which would otherwise drop them.
+	flagOverrides := func(c *monitor.Config) {
+		if *unit != "" {
+			c.ForceUnit = cfg.ForceUnit
+		}
+		if *snapshotPath != "" {
+			c.PrometheusSnapshotPath = *snapshotPath
+		}
+	}
+	flagOverrides(cfg)
+
+	if *testDiscord {
+		sendTestDiscord(ctx, cfg, logger)
+		return nil
+	}
+	if *checkConfig {
+		return checkConfigFile(ctx, cfg, logger)
+	}
+	if *showTraits {
+		return showDeviceTraits(ctx, cfg, *device, *trait, logger)
+	}
+
+	start := time.Now()
+	rdb := cfg.RedisClient()
+	defer func() {
+		if err := rdb.Close(); err != nil {
+			logger.Warn("failed to close redis", "err", err)
+		}
+		logger.Info("finished", "elapsed", time.Since(start).Round(time.Millisecond))
+	}()
+
+	opts := []monitor.Option{monitor.WithConfig(cfg), monitor.WithRedisClient(rdb), monitor.WithLogger(logger), monitor.WithDeviceFilter(*device)}
+	if *dryRun {
+		opts = append(opts, monitor.WithDryRun())
+	}
+	if *debugSamples {
+		opts = append(opts, monitor.WithSampleTable(os.Stdout))
+	}
+	if *profile {
+		if cfg.AdminToken == "" {
+			err := errors.New("-profile needs admin_token in config")
+			logger.Error("invalid flags", "err", err)
+			return err
+		}
+		opts = append(opts, monitor.WithProfiling())
+	}
+	m, err := monitor.NewMonitor(opts...)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		logger.Error("invalid config", "path", *configPath, "err", err)
+		m.Alert(ctx, monitor.AlertEvent{Type: monitor.AlertConfigError, DeviceID: "N/A", Message: "Invalid config: " + err.Error()})
+		return err
+	}
+	if err := m.CheckRedis(ctx); err != nil {
+		return err
+	}
+	if *simulate != "" {
+		if err := m.SimulateAnomaly(ctx, *simulate); err != nil {
+			logger.Error("simulation failed", "type", *simulate, "err", err)
+			return err
+		}
+		logger.Info("simulation complete", "type", *simulate, "device_id", monitor.SimulatedDeviceID)
+		return nil
+	}
+	if *reprocess {
+		alerts, err := m.ReprocessSamples(ctx)
+		if err != nil {
+			logger.Error("reprocessing failed", "err", err)
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tDEVICE ID\tALERT\tMESSAGE")
+		for _, a := range alerts {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", a.Time.Format(time.RFC3339), a.DeviceID, a.Type, a.Message)
+		}
+		w.Flush()
+		logger.Info("reprocessing complete", "would_alert", len(alerts))
+		return nil
+	}
+	if *migrateEncoding {
+		n, err := m.MigrateSampleEncoding(ctx)
+		if err != nil {
+			logger.Error("sample migration failed", "migrated", n, "err", err)
+			return err
+		}
+		logger.Info("sample migration complete", "encoding", cfg.RedisSampleEncoding, "devices", n)
+		return nil
+	}
+	if *migrateV1 {
+		report, err := m.MigrateKeysV1ToV2(ctx, *namespace, *deleteOld)
+		fmt.Printf("Keys found: %d, migrated: %d, skipped (already in new format): %d\n", report.Found, report.Migrated, report.Skipped)
+		if err != nil {
+			logger.Error("key migration failed", "namespace", *namespace, "err", err)
+			return err
+		}
+		return nil
+	}
+	if *backfill {
+		if err := m.Backfill(ctx); err != nil {
+			logger.Error("backfill failed", "err", err)
+			return err
+		}
+	}
+
+	if *pubSubMode || *pushMode {
+		reports, err := m.ScheduleReports()
+		if err != nil {
+			logger.Error("failed to schedule reports", "err", err)
+			return err
+		}
+		if reports != nil {
+			defer reports.Stop()
+		}
+		go m.Health().Run(ctx)
+		go m.RunEscalations(ctx)
+		if *grpcAddr != "" && cfg.GRPCCertFile != "" {
+			go serveGRPC(m, *grpcAddr, logger)
+		}
+		if *profile && *httpAddr == "" {
+			go serveProfiles(m, *pprofAddr, logger)
+		}
+	}
+
+	if *pubSubMode {
+		if cfg.PubSubSubscription == "" {
+			err := errors.New("pubsub_subscription must be set in config to use -pubsub-mode")
+			logger.Error(err.Error())
+			return err
+		}
+		go watchSIGHUP(m, *configPath, flagOverrides, logger)
+		if *httpAddr != "" {
+			go serveHTTP(m, *httpAddr, logger)
+		}
+		return m.Watchdog().Run(ctx, m.RunPubSub)
+	}
+
+	if *pushMode {
+		if *httpAddr == "" || cfg.PubSubPushAudience == "" {
+			err := errors.New("-push-mode needs -http-addr and pubsub_push_audience in config")
+			logger.Error(err.Error())
+			return err
+		}
+		go watchSIGHUP(m, *configPath, flagOverrides, logger)
+		go serveHTTP(m, *httpAddr, logger)
+		return m.Watchdog().Run(ctx, m.RunPush)
+	}
+
+	return m.Run(ctx)
+}
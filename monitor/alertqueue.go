@@ -0,0 +1,84 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// alertQueueKey holds alerts Pushover couldn't take, newest first, to be
+	// resent once it is reachable again.
+	alertQueueKey = "nest:alert_queue"
+	alertQueueLen = 100
+	// alertQueueFlushBatch is how many queued alerts each successful
+	// Pushover send resends.
+	alertQueueFlushBatch = 5
+)
+
+// QueuedAlert is an alert waiting in nest:alert_queue.
+type QueuedAlert struct {
+	Event    AlertEvent `json:"event"`
+	QueuedAt time.Time  `json:"queued_at"`
+	Error    string     `json:"error"`
+}
+
+// queueAlert keeps an alert Pushover failed to deliver, so it isn't lost
+// during an outage.
+func (m *Monitor) queueAlert(ctx context.Context, event AlertEvent, deliveryErr error) {
+	if m.rdb == nil || event.Queued {
+		return
+	}
+	data, _ := json.Marshal(QueuedAlert{Event: event, QueuedAt: time.Now(), Error: deliveryErr.Error()})
+	_, err := m.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.LPush(ctx, alertQueueKey, data)
+		p.LTrim(ctx, alertQueueKey, 0, alertQueueLen-1)
+		return nil
+	})
+	if err != nil {
+		m.logger.Warn("failed to queue alert", "type", event.Type, "device_id", event.DeviceID, "err", err)
+	}
+}
+
+// flushAlertQueue resends up to alertQueueFlushBatch queued alerts, oldest
+// first, through the Pushover notifier each would have gone to, titled
+// [QUEUED]. An alert that fails again goes back to the front of the queue
+// and the flush stops.
+func (m *Monitor) flushAlertQueue(ctx context.Context) {
+	if m.rdb == nil {
+		return
+	}
+	for i := 0; i < alertQueueFlushBatch; i++ {
+		data, err := m.rdb.RPop(ctx, alertQueueKey).Result()
+		if err != nil {
+			if err != redis.Nil {
+				m.logger.Warn("failed to read alert queue", "err", err)
+			}
+			return
+		}
+		var q QueuedAlert
+		if err := json.Unmarshal([]byte(data), &q); err != nil {
+			m.logger.Warn("dropping malformed queued alert", "err", err)
+			continue
+		}
+		q.Event.Queued = true
+		var pushover Notifier
+		for _, n := range m.notifiersFor(q.Event) {
+			if n.Name() == "pushover" {
+				pushover = n
+			}
+		}
+		if pushover == nil {
+			m.logger.Warn("dropping queued alert with no Pushover notifier", "type", q.Event.Type, "device_id", q.Event.DeviceID)
+			continue
+		}
+		if err := pushover.Notify(ctx, q.Event); err != nil {
+			m.logger.Warn("failed to resend queued alert", "type", q.Event.Type, "device_id", q.Event.DeviceID, "err", err)
+			m.rdb.RPush(ctx, alertQueueKey, data)
+			return
+		}
+		m.logger.Info("queued alert sent", "type", q.Event.Type, "device_id", q.Event.DeviceID, "queued_at", q.QueuedAt)
+	}
+}
@@ -0,0 +1,125 @@
+package monitor
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// alertHistoryLen is how many alerts are kept per device.
+const alertHistoryLen = 100
+
+// alertsKey lists a device's alerts, newest first.
+func alertsKey(deviceID string) string {
+	return fmt.Sprintf("nest:%s:alerts", deviceID)
+}
+
+// ListAlertHistory returns up to limit of the device's most recent alerts,
+// newest first. A limit of zero or less returns all of them.
+func (m *Monitor) ListAlertHistory(deviceID string, limit int) ([]AlertEvent, error) {
+	stop := int64(limit) - 1
+	if limit <= 0 {
+		stop = -1
+	}
+	raw, err := m.rdb.LRange(context.Background(), alertsKey(deviceID), 0, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+	events := make([]AlertEvent, 0, len(raw))
+	for _, r := range raw {
+		var e AlertEvent
+		if err := json.Unmarshal([]byte(r), &e); err == nil {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// ClearAlerts forgets a device's alert history, active anomaly and pending
+// escalations, so the next occurrence alerts again as if it were new.
+func (m *Monitor) ClearAlerts(deviceID string) error {
+	err := m.rdb.Del(context.Background(), alertsKey(deviceID), activeAnomalyKey(deviceID), escalationKey(deviceID)).Err()
+	if err != nil {
+		return err
+	}
+	m.logger.Info("alerts cleared", "device_id", deviceID)
+	return nil
+}
+
+// serveAlerts handles /alerts/{deviceID}: GET lists the device's alert
+// history (?limit=N, default 20) and DELETE clears it. DELETE needs an
+// X-Admin-Token header matching admin_token, and is refused when no token is
+// configured. POST /alerts/{deviceID}/ack acknowledges the device's latest
+// emergency alert, with the same token check.
+func (m *Monitor) serveAlerts(w http.ResponseWriter, r *http.Request) {
+	deviceID, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/alerts/"), "/")
+	if deviceID == "" || (action != "" && action != "ack") {
+		http.NotFound(w, r)
+		return
+	}
+
+	if action == "ack" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !m.adminAuthorized(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err := m.AcknowledgeAlert(r.Context(), deviceID); err != nil {
+			m.logger.Error("failed to acknowledge alert", "device_id", deviceID, "err", err)
+			http.Error(w, "failed to acknowledge alert", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		limit := 20
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		events, err := m.ListAlertHistory(deviceID, limit)
+		if err != nil {
+			m.logger.Error("failed to list alerts", "device_id", deviceID, "err", err)
+			http.Error(w, "failed to list alerts", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(events)
+
+	case http.MethodDelete:
+		if !m.adminAuthorized(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err := m.ClearAlerts(deviceID); err != nil {
+			m.logger.Error("failed to clear alerts", "device_id", deviceID, "err", err)
+			http.Error(w, "failed to clear alerts", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// adminAuthorized reports whether r carries an X-Admin-Token matching
+// admin_token. It is always false when no token is configured.
+func (m *Monitor) adminAuthorized(r *http.Request) bool {
+	token := m.config().AdminToken
+	return token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Admin-Token")), []byte(token)) == 1
+}
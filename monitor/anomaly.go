@@ -0,0 +1,278 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func samplesKey(deviceID string) string {
+	return fmt.Sprintf("nest:%s:temps", deviceID)
+}
+
+// sampleStoredTTL is how long a sampleStoredKey outlives the write it marks,
+// which only has to cover withRetry's reconnect attempts.
+const sampleStoredTTL = time.Hour
+
+// sampleStoredKey is set in the same transaction that stores a sample, so a
+// retry can tell whether the sample was stored before the connection dropped.
+func sampleStoredKey(deviceID string, ts time.Time) string {
+	return fmt.Sprintf("nest:%s:stored:%d", deviceID, ts.UnixNano())
+}
+
+// activeAnomalyKey holds the alert type of the trend anomaly currently
+// active on a device, so the alert fires once per episode instead of on
+// every poll.
+func activeAnomalyKey(deviceID string) string {
+	return fmt.Sprintf("nest:%s:active_anomaly", deviceID)
+}
+
+// staleGap returns the first gap between consecutive samples, newest first,
+// that is longer than maxGap, or 0 if there is none. A trend across such a
+// gap, e.g. after the monitor was down, doesn't mean anything.
+func staleGap(samples []Sample, maxGap time.Duration) time.Duration {
+	for i := 1; i < len(samples); i++ {
+		if gap := samples[i-1].Ts.Sub(samples[i].Ts); gap > maxGap {
+			return gap
+		}
+	}
+	return 0
+}
+
+// freshSamples returns the leading samples, newest first, taken no more than
+// maxAge before now. Older ones, e.g. left in Redis while the monitor was
+// offline, say nothing about current conditions.
+func freshSamples(samples []Sample, now time.Time, maxAge time.Duration) []Sample {
+	for i, s := range samples {
+		if now.Sub(s.Ts) > maxAge {
+			return samples[:i]
+		}
+	}
+	return samples
+}
+
+// AmbientTrend is a least-squares fit of ambient temperature over time.
+type AmbientTrend struct {
+	// Slope is in degrees per minute.
+	Slope float64
+	// R2 is the coefficient of determination, from 0 (no fit) to 1.
+	R2 float64
+	// Direction is "rising", "falling" or "flat".
+	Direction string
+}
+
+// computeTrend fits a line to the ambient readings in samples against their
+// timestamps.
+func computeTrend(samples []Sample) AmbientTrend {
+	trend := AmbientTrend{Direction: "flat"}
+	if len(samples) < 2 {
+		return trend
+	}
+	n := float64(len(samples))
+	origin := samples[len(samples)-1].Ts
+	var sumX, sumY float64
+	for _, s := range samples {
+		sumX += s.Ts.Sub(origin).Minutes()
+		sumY += s.Ambient
+	}
+	meanX, meanY := sumX/n, sumY/n
+	var sxx, sxy, syy float64
+	for _, s := range samples {
+		dx, dy := s.Ts.Sub(origin).Minutes()-meanX, s.Ambient-meanY
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 {
+		return trend
+	}
+	trend.Slope = sxy / sxx
+	if syy > 0 {
+		trend.R2 = sxy * sxy / (sxx * syy)
+	}
+	switch {
+	case trend.Slope > 0:
+		trend.Direction = "rising"
+	case trend.Slope < 0:
+		trend.Direction = "falling"
+	}
+	return trend
+}
+
+// detectTrend checks a window of samples in unit, newest first, for the HVAC
+// running the whole time while ambient moves the wrong way: faster than
+// trend_slope_threshold °F per minute, with a fit better than
+// trend_r2_threshold so one noisy reading neither makes nor breaks a trend.
+// It returns the matching alert type, or "" if there is no anomaly.
+func detectTrend(samples []Sample, unit string, cfg *Config) string {
+	if len(samples) < 2 {
+		return ""
+	}
+	cooling, heating := true, true
+	for _, s := range samples {
+		cooling = cooling && s.HvacState == "COOLING"
+		heating = heating && s.HvacState == "HEATING"
+	}
+	if !cooling && !heating {
+		return ""
+	}
+	trend := computeTrend(samples)
+	slopeF := trend.Slope
+	if unit != "FAHRENHEIT" {
+		slopeF = trend.Slope * 9 / 5
+	}
+	if math.Abs(slopeF) <= cfg.TrendSlopeThreshold || trend.R2 <= cfg.TrendR2Threshold {
+		return ""
+	}
+	switch {
+	case cooling && trend.Direction == "rising":
+		return AlertCoolingRising
+	case heating && trend.Direction == "falling":
+		return AlertHeatingFalling
+	}
+	return ""
+}
+
+// sampleDelta is the change in ambient from s1 to the newer s0.
+func sampleDelta(s0, s1 Sample) float64 {
+	return s0.Ambient - s1.Ambient
+}
+
+// checkSuddenDrop alerts at once when ambient falls by more than
+// single_cycle_drop_threshold_f between two consecutive polls while heating,
+// which points to a failed sensor or an open door rather than a slow trend.
+func (m *Monitor) checkSuddenDrop(ctx context.Context, deviceID string, samples []Sample) {
+	msg := detectSuddenDrop(samples, m.sampleUnit(deviceID), m.config())
+	if msg == "" {
+		return
+	}
+	newest := samples[0]
+	m.logger.Warn("sudden ambient drop while heating", "device_id", deviceID, "from", samples[1].Ambient, "to", newest.Ambient)
+	ambient := newest.Ambient
+	m.Alert(ctx, AlertEvent{
+		Type:     AlertSuddenDrop,
+		DeviceID: deviceID,
+		Message:  msg,
+		Ambient:  &ambient,
+		Occupied: newest.Occupied,
+	})
+}
+
+// detectSuddenDrop returns the sudden_drop message for the newest two of
+// samples, in unit, or "" if ambient didn't drop far enough while heating.
+func detectSuddenDrop(samples []Sample, unit string, cfg *Config) string {
+	if len(samples) < 2 {
+		return ""
+	}
+	newest, previous := samples[0], samples[1]
+	if newest.HvacState != "HEATING" || newest.Ts.Sub(previous.Ts) > cfg.maxSampleGap() {
+		return ""
+	}
+	delta := sampleDelta(newest, previous)
+	deltaF := delta
+	if unit != "FAHRENHEIT" {
+		deltaF = delta * 9 / 5
+	}
+	if deltaF >= -cfg.SingleCycleDropThresholdF {
+		return ""
+	}
+	return fmt.Sprintf("HEATING: ambient dropped %.1f in one poll (%.1f → %.1f)", -delta, previous.Ambient, newest.Ambient)
+}
+
+// trendMessage describes a trend anomaly with its readings oldest first.
+func trendMessage(alertType string, samples []Sample) string {
+	readings := make([]string, len(samples))
+	for i, s := range samples {
+		readings[len(samples)-1-i] = fmt.Sprintf("%.1f", s.Ambient)
+	}
+	trend := strings.Join(readings, " → ")
+	if alertType == AlertCoolingRising {
+		return fmt.Sprintf("COOLING: ambient consistently rising (%s)", trend)
+	}
+	return fmt.Sprintf("HEATING: ambient consistently falling (%s)", trend)
+}
+
+// checkAnomaly alerts when a trend anomaly starts on a device and clears the
+// active marker once it's over. A heating failure also turns the thermostat
+// off.
+func (m *Monitor) checkAnomaly(ctx context.Context, deviceID string, samples []Sample, token string) error {
+	key := activeAnomalyKey(deviceID)
+	active, err := m.rdb.Get(ctx, key).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("reading active anomaly: %w", err)
+	}
+
+	anomaly := detectTrend(samples, m.sampleUnit(deviceID), m.config())
+	switch {
+	case anomaly == "" && active != "":
+		m.logger.Info("anomaly cleared", "device_id", deviceID, "type", active)
+		if err := m.rdb.Del(ctx, key).Err(); err != nil {
+			return err
+		}
+		if m.config().AutoRestore {
+			return m.restoreAfterShutoff(ctx, deviceID, token)
+		}
+		return nil
+	case anomaly == "":
+		return nil
+	case anomaly == active:
+		m.logger.Debug("anomaly still active", "device_id", deviceID, "type", anomaly)
+		return nil
+	}
+
+	if err := m.rdb.Set(ctx, key, anomaly, 0).Err(); err != nil {
+		return fmt.Errorf("marking anomaly active: %w", err)
+	}
+	ambient := samples[0].Ambient
+	m.Alert(ctx, AlertEvent{
+		Type:     anomaly,
+		DeviceID: deviceID,
+		Message:  trendMessage(anomaly, samples) + m.historicalNote(ctx, deviceID, ambient),
+		Ambient:  &ambient,
+		Occupied: samples[0].Occupied,
+	})
+	if anomaly == AlertHeatingFalling {
+		m.turnOffThermostat(ctx, deviceID, token)
+	}
+	return nil
+}
+
+// Backfill re-derives each device's active anomaly from the samples already
+// stored in Redis, without alerting. Run at startup, it stops a trend that
+// began before a restart from alerting again, and keeps one that was in
+// progress marked as active.
+func (m *Monitor) Backfill(ctx context.Context) error {
+	window := int64(m.config().SampleWindow)
+	iter := m.rdb.Scan(ctx, 0, samplesKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		deviceID := strings.TrimSuffix(strings.TrimPrefix(key, "nest:"), ":temps")
+
+		raw, err := m.rdb.LRange(ctx, key, 0, window-1).Result()
+		if err != nil {
+			return fmt.Errorf("%s: %w", deviceID, err)
+		}
+		samples := decodeSamples(raw)
+
+		anomaly := ""
+		if int64(len(samples)) == window && staleGap(samples, m.config().maxSampleGap()) == 0 {
+			anomaly = detectTrend(samples, m.sampleUnit(deviceID), m.config())
+		}
+		if anomaly == "" {
+			if err := m.rdb.Del(ctx, activeAnomalyKey(deviceID)).Err(); err != nil {
+				return fmt.Errorf("%s: %w", deviceID, err)
+			}
+			m.logger.Debug("no active anomaly at backfill", "device_id", deviceID, "samples", len(samples))
+			continue
+		}
+		if err := m.rdb.Set(ctx, activeAnomalyKey(deviceID), anomaly, 0).Err(); err != nil {
+			return fmt.Errorf("%s: %w", deviceID, err)
+		}
+		m.logger.Info("anomaly active at backfill", "device_id", deviceID, "type", anomaly)
+	}
+	return iter.Err()
+}
@@ -0,0 +1,26 @@
+package monitor
+
+import "testing"
+
+func TestDetectTrendThresholdIsFahrenheit(t *testing.T) {
+	// Falling 0.015 degrees a minute: 0.027°F/min on a Celsius device, over
+	// the default threshold of 0.02, but under it on a Fahrenheit one.
+	samples := []Sample{
+		{Ambient: 20.7, HvacState: "HEATING", Ts: minutesAgo(0)},
+		{Ambient: 20.85, HvacState: "HEATING", Ts: minutesAgo(10)},
+		{Ambient: 21, HvacState: "HEATING", Ts: minutesAgo(20)},
+	}
+	cfg := testConfig(t, nil)
+	tests := []struct {
+		unit string
+		want string
+	}{
+		{"CELSIUS", AlertHeatingFalling},
+		{"FAHRENHEIT", ""},
+	}
+	for _, tt := range tests {
+		if got := detectTrend(samples, tt.unit, cfg); got != tt.want {
+			t.Errorf("detectTrend in %s = %q, want %q", tt.unit, got, tt.want)
+		}
+	}
+}
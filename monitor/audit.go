@@ -0,0 +1,195 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/redis/go-redis/v9"
+)
+
+// Audit backends, selected by Config.AuditBackend.
+const (
+	auditBackendFile  = "file"
+	auditBackendRedis = "redis"
+	auditBackendS3    = "s3"
+)
+
+// operatorMonitor is the operator recorded for commands the monitor sends on
+// its own, e.g. turning a thermostat off after a heating failure.
+const operatorMonitor = "monitor"
+
+// AuditEntry records one command sent to a thermostat.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Operator is "monitor", or who asked for the command, e.g.
+	// "http 10.0.0.5:51234" for a call to an admin endpoint.
+	Operator string         `json:"operator"`
+	DeviceID string         `json:"device_id"`
+	Command  string         `json:"command"`
+	Params   map[string]any `json:"params,omitempty"`
+	// Result is "ok" or "error"; Error holds the error for the latter.
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// AuditLogger appends entries to a log that nothing in the monitor ever
+// rewrites or trims.
+type AuditLogger interface {
+	Log(ctx context.Context, entry AuditEntry) error
+}
+
+// FileAuditLogger appends entries to a file as JSON lines. Making the file
+// itself append-only, e.g. with chattr +a, is left to the host.
+type FileAuditLogger struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (f *FileAuditLogger) Log(ctx context.Context, entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.OpenFile(f.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// RedisAuditLogger adds entries to a Redis stream with XADD, without a
+// MAXLEN, so the stream is never trimmed.
+type RedisAuditLogger struct {
+	Client *redis.Client
+	Stream string
+}
+
+func (r *RedisAuditLogger) Log(ctx context.Context, entry AuditEntry) error {
+	if r.Client == nil {
+		return errors.New("no Redis client")
+	}
+	params, err := json.Marshal(entry.Params)
+	if err != nil {
+		return err
+	}
+	return r.Client.XAdd(ctx, &redis.XAddArgs{
+		Stream: r.Stream,
+		Values: map[string]any{
+			"time":      entry.Time.Format(time.RFC3339Nano),
+			"operator":  entry.Operator,
+			"device_id": entry.DeviceID,
+			"command":   entry.Command,
+			"params":    params,
+			"result":    entry.Result,
+			"error":     entry.Error,
+		},
+	}).Err()
+}
+
+// S3AuditLogger puts each entry in its own object under Prefix, since S3
+// objects can't be appended to. Enabling Object Lock on the bucket makes
+// them immutable.
+type S3AuditLogger struct {
+	Client *s3.Client
+	Bucket string
+	Prefix string
+}
+
+func (s *S3AuditLogger) Log(ctx context.Context, entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	t := entry.Time.UTC()
+	key := fmt.Sprintf("%s%s/%s-%s.json", s.Prefix, t.Format("2006/01/02"), t.Format("150405.000000000"), newRequestID())
+	_, err = s.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+// configuredAuditLogger builds the audit_backend logger, or returns nil when
+// audit_enabled is off. The S3 client is built once here, with credentials
+// from the environment as for reports, rather than for every entry.
+func configuredAuditLogger(cfg *Config, rdb *redis.Client) (AuditLogger, error) {
+	if !cfg.AuditEnabled {
+		return nil, nil
+	}
+	switch cfg.AuditBackend {
+	case auditBackendRedis:
+		return &RedisAuditLogger{Client: rdb, Stream: cfg.AuditRedisStream}, nil
+	case auditBackendS3:
+		awsCfg, err := awsconfig.LoadDefaultConfig(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("loading AWS config for the audit log: %w", err)
+		}
+		return &S3AuditLogger{Client: s3.NewFromConfig(awsCfg), Bucket: cfg.AuditS3Bucket, Prefix: cfg.AuditS3Prefix}, nil
+	default:
+		return &FileAuditLogger{Path: cfg.AuditFilePath}, nil
+	}
+}
+
+type operatorKey struct{}
+
+// WithOperator tags ctx with who asked for the thermostat commands sent
+// under it, for the audit log.
+func WithOperator(ctx context.Context, operator string) context.Context {
+	return context.WithValue(ctx, operatorKey{}, operator)
+}
+
+func operatorFrom(ctx context.Context) string {
+	if op, ok := ctx.Value(operatorKey{}).(string); ok {
+		return op
+	}
+	return operatorMonitor
+}
+
+// executeCommand sends an SDM command to the device and, with audit_enabled,
+// records it in the audit log whether or not it succeeded. Every thermostat
+// command goes through here so none can skip the log. If the API rejects
+// token, the command is sent once more with a new one. A failed audit write
+// doesn't undo the command, so it is alerted rather than returned.
+func (m *Monitor) executeCommand(ctx context.Context, deviceID, command string, params map[string]any, token string) error {
+	err := m.withTokenRetry(ctx, token, func(token string) error {
+		return m.client.ExecuteCommand(ctx, token, m.deviceName(deviceID), command, params)
+	})
+	if m.audit == nil || m.dryRun {
+		return err
+	}
+	entry := AuditEntry{
+		Time:     time.Now(),
+		Operator: operatorFrom(ctx),
+		DeviceID: deviceID,
+		Command:  strings.TrimPrefix(command, "sdm.devices.commands."),
+		Params:   params,
+		Result:   "ok",
+	}
+	if err != nil {
+		entry.Result, entry.Error = "error", err.Error()
+	}
+	if auditErr := m.audit.Log(ctx, entry); auditErr != nil {
+		m.logger.Error("failed to write audit log", "device_id", deviceID, "command", entry.Command, "err", auditErr)
+		m.alert(ctx, AlertAuditFailed, deviceID, fmt.Sprintf("Failed to record %s in the audit log: %v", entry.Command, auditErr))
+	}
+	return err
+}
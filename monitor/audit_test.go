@@ -0,0 +1,92 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestS3AuditLoggerPutsEachEntry(t *testing.T) {
+	var mu sync.Mutex
+	puts := map[string]AuditEntry{}
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		Credentials:  aws.AnonymousCredentials{},
+		UsePathStyle: true,
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			var entry AuditEntry
+			if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+				t.Errorf("PUT %s: %v", r.URL.Path, err)
+			}
+			mu.Lock()
+			puts[r.Method+" "+r.URL.Path] = entry
+			mu.Unlock()
+			return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("")), Request: r}, nil
+		})},
+	})
+	logger := &S3AuditLogger{Client: client, Bucket: "audit", Prefix: "thermostats/"}
+
+	ts := time.Date(2024, 1, 15, 7, 30, 0, 0, time.UTC)
+	for _, command := range []string{"ThermostatMode.SetMode", "ThermostatTemperatureSetpoint.SetHeat"} {
+		entry := AuditEntry{Time: ts, Operator: operatorMonitor, DeviceID: "dev1", Command: command, Result: "ok"}
+		if err := logger.Log(context.Background(), entry); err != nil {
+			t.Fatalf("Log: %v", err)
+		}
+	}
+
+	if len(puts) != 2 {
+		t.Fatalf("made %d distinct requests for two entries, want 2: %v", len(puts), puts)
+	}
+	for req, entry := range puts {
+		if !strings.HasPrefix(req, "PUT /audit/thermostats/2024/01/15/073000.000000000-") {
+			t.Errorf("request %s, want a PUT under the day's prefix", req)
+		}
+		if entry.DeviceID != "dev1" || entry.Result != "ok" {
+			t.Errorf("stored entry %+v, want dev1's", entry)
+		}
+	}
+}
+
+func TestConfiguredAuditLoggerBuildsS3Client(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	cfg := testConfig(t, map[string]any{"audit_enabled": true, "audit_backend": "s3", "audit_s3_bucket": "audit"})
+
+	audit, err := configuredAuditLogger(cfg, nil)
+	if err != nil {
+		t.Fatalf("configuredAuditLogger: %v", err)
+	}
+	s3Logger, ok := audit.(*S3AuditLogger)
+	if !ok || s3Logger.Client == nil || s3Logger.Bucket != "audit" {
+		t.Errorf("configuredAuditLogger = %+v, want an S3AuditLogger with its client", audit)
+	}
+}
+
+func TestNewFailsWithBrokenAWSConfig(t *testing.T) {
+	dir := t.TempDir()
+	// A profile that isn't in the shared config files.
+	t.Setenv("AWS_PROFILE", "missing")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	cfg := testConfig(t, map[string]any{"audit_enabled": true, "audit_backend": "s3", "audit_s3_bucket": "audit"})
+
+	m, err := New(cfg, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err == nil || !strings.Contains(err.Error(), "AWS config") {
+		t.Errorf("New error = %v, want one loading the AWS config", err)
+	}
+	if m != nil {
+		t.Errorf("New returned a Monitor along with its error")
+	}
+}
@@ -0,0 +1,75 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// restorePendingKey exists while a device shut off by the monitor may still
+// be restored automatically. It expires after restore_after_minutes.
+func restorePendingKey(deviceID string) string {
+	return fmt.Sprintf("nest:%s:restore_pending", deviceID)
+}
+
+// markRestorePending starts the auto_restore window for a device that has
+// just been turned off.
+func (m *Monitor) markRestorePending(ctx context.Context, deviceID string) error {
+	ttl := time.Duration(m.config().RestoreAfterMinutes) * time.Minute
+	return m.rdb.Set(ctx, restorePendingKey(deviceID), time.Now().Unix(), ttl).Err()
+}
+
+// sampleUnit is the unit a device's samples are reported in: the forced unit
+// if there is one, else the device's display unit from its last known
+// traits, else Celsius.
+func (m *Monitor) sampleUnit(deviceID string) string {
+	if unit := m.config().forcedUnit(); unit != "" {
+		return unit
+	}
+	if d := m.traits.device(m.deviceName(deviceID)); d != nil && d.Unit != "" {
+		return d.Unit
+	}
+	return "CELSIUS"
+}
+
+// checkRestorePending restores a device that auto_restore is waiting on once
+// ambient is back within recovery_threshold_f of the setpoints it had before
+// it was turned off.
+func (m *Monitor) checkRestorePending(ctx context.Context, deviceID string, sample Sample, token string) error {
+	cfg := m.config()
+	if !cfg.AutoRestore {
+		return nil
+	}
+	pending, err := m.rdb.Exists(ctx, restorePendingKey(deviceID)).Result()
+	if err != nil || pending == 0 {
+		return err
+	}
+	state, err := m.rdb.HGetAll(ctx, shutoffKey(deviceID)).Result()
+	if err != nil {
+		return err
+	}
+	if len(state) == 0 {
+		// Already restored, e.g. when the trend cleared.
+		return m.rdb.Del(ctx, restorePendingKey(deviceID)).Err()
+	}
+	heat, _ := strconv.ParseFloat(state["heat_celsius"], 64)
+	cool, _ := strconv.ParseFloat(state["cool_celsius"], 64)
+
+	ambient := sample.Ambient
+	if m.sampleUnit(deviceID) == "FAHRENHEIT" {
+		ambient = fToC(ambient)
+	}
+	threshold := cfg.RecoveryThresholdF * 5 / 9
+	if (heat != 0 && ambient < heat-threshold) || (cool != 0 && ambient > cool+threshold) {
+		return nil
+	}
+
+	m.logger.Info("ambient recovered, restoring thermostat", "device_id", deviceID, "ambient", sample.Ambient)
+	if err := m.restoreAfterShutoff(ctx, deviceID, token); err != nil {
+		// It has been alerted. restore_pending is kept, so the next poll in
+		// the window tries again, and the sample is still stored.
+		m.logger.Warn("auto-restore failed, retrying next poll", "device_id", deviceID, "err", err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAutoRestoreRetriesAfterFailure(t *testing.T) {
+	// Turned off while heating to 21°C, and ambient has recovered to 20.5°C.
+	d := testDevice(t, "dev1", 20.5, "OFF", 0)
+	client := &MockThermostatClient{Devices: []Device{d}, CommandErr: errors.New("connection reset")}
+	tm := newTestMonitor(t, testConfig(t, map[string]any{"auto_restore": true}), client)
+	ctx := context.Background()
+	tm.rdb.HSet(ctx, shutoffKey("dev1"), "mode", "HEAT", "heat_celsius", "21", "cool_celsius", "0")
+	if err := tm.markRestorePending(ctx, "dev1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if errs := tm.processDevices(ctx, []Device{d}, "token"); len(errs) > 0 {
+		t.Fatalf("processDevices: %v", errs)
+	}
+	if alerts := tm.notifier.ofType(AlertTurnOnFailed); len(alerts) != 1 {
+		t.Errorf("sent %d %s alerts, want 1", len(alerts), AlertTurnOnFailed)
+	}
+	for _, key := range []string{shutoffKey("dev1"), restorePendingKey("dev1")} {
+		if !tm.redis.Exists(key) {
+			t.Errorf("%s was deleted after a failed restore", key)
+		}
+	}
+	if n := len(tm.storedSamples(t, "dev1")); n != 1 {
+		t.Errorf("stored %d samples, want 1", n)
+	}
+
+	// The next poll tries again, and this time the restore goes through.
+	tm.client.mu.Lock()
+	tm.client.CommandErr = nil
+	tm.client.mu.Unlock()
+	if errs := tm.processDevices(ctx, []Device{d}, "token"); len(errs) > 0 {
+		t.Fatalf("processDevices: %v", errs)
+	}
+	if alerts := tm.notifier.ofType(AlertTurnOnSuccess); len(alerts) != 1 {
+		t.Errorf("sent %d %s alerts, want 1", len(alerts), AlertTurnOnSuccess)
+	}
+	for _, key := range []string{shutoffKey("dev1"), restorePendingKey("dev1")} {
+		if tm.redis.Exists(key) {
+			t.Errorf("%s was kept after a successful restore", key)
+		}
+	}
+}
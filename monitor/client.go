@@ -0,0 +1,148 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const sdmBaseURL = "https://smartdevicemanagement.googleapis.com/v1"
+
+var errDeviceNotFound = errors.New("device not found")
+
+// errMalformedDevice wraps a device whose traits couldn't be parsed. Only
+// that device is skipped, so a new model or a bad trait doesn't stop the
+// others from being monitored.
+var errMalformedDevice = errors.New("malformed device")
+
+// ThermostatClient is the subset of the SDM API the monitor uses. SDMClient
+// is the real implementation; tests can substitute fixtures.
+type ThermostatClient interface {
+	FetchDevices(ctx context.Context, token string) ([]Device, error)
+	FetchDevice(ctx context.Context, token, deviceName string) (Device, error)
+	ExecuteCommand(ctx context.Context, token, deviceName, command string, params map[string]any) error
+}
+
+// APIError is returned for non-200 responses from the SDM API.
+type APIError struct {
+	StatusCode int
+	RequestID  string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("SDM API returned status %d (request %s)", e.StatusCode, e.RequestID)
+}
+
+func (e *APIError) Is(target error) bool {
+	return target == errDeviceNotFound && e.StatusCode == http.StatusNotFound
+}
+
+type SDMClient struct {
+	ProjectID  string
+	HTTPClient *http.Client
+	Logger     *slog.Logger
+	// Redis, if set, keeps the last few request IDs sent for each device.
+	Redis *redis.Client
+	// MaxRetryAfter caps how long a rate-limited request waits before it is
+	// retried. Zero means no cap.
+	MaxRetryAfter time.Duration
+}
+
+func (c *SDMClient) FetchDevices(ctx context.Context, token string) ([]Device, error) {
+	var result struct {
+		Devices []Device `json:"devices"`
+	}
+	requestID, err := c.call(ctx, token, "GET", fmt.Sprintf("%s/enterprises/%s/devices", sdmBaseURL, c.ProjectID), nil, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []Device
+	for _, raw := range result.Devices {
+		c.recordRequestID(ctx, deviceIDFromName(raw.Name), requestID)
+		d, err := UnmarshalDevice(raw.traitMap())
+		if err != nil {
+			c.Logger.Error("skipping malformed device", "device", raw.Name, "err", err)
+			continue
+		}
+		devices = append(devices, *d)
+	}
+	return devices, nil
+}
+
+func (c *SDMClient) FetchDevice(ctx context.Context, token, deviceName string) (Device, error) {
+	var raw Device
+	requestID, err := c.call(ctx, token, "GET", fmt.Sprintf("%s/%s", sdmBaseURL, deviceName), nil, &raw)
+	c.recordRequestID(ctx, deviceIDFromName(deviceName), requestID)
+	if err != nil {
+		return Device{}, fmt.Errorf("%s: %w", deviceName, err)
+	}
+	d, err := UnmarshalDevice(raw.traitMap())
+	if err != nil {
+		return Device{}, fmt.Errorf("%w: %v", errMalformedDevice, err)
+	}
+	return *d, nil
+}
+
+func (c *SDMClient) ExecuteCommand(ctx context.Context, token, deviceName, command string, params map[string]any) error {
+	payload := map[string]any{
+		"command": command,
+		"params":  params,
+	}
+	requestID, err := c.call(ctx, token, "POST", fmt.Sprintf("%s/%s:executeCommand", sdmBaseURL, deviceName), payload, nil)
+	c.recordRequestID(ctx, deviceIDFromName(deviceName), requestID)
+	return err
+}
+
+// call sends an authenticated request and decodes a JSON response into out,
+// returning the request ID it was sent with.
+func (c *SDMClient) call(ctx context.Context, token, method, url string, payload, out any) (string, error) {
+	var body *bytes.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return "", err
+		}
+		body = bytes.NewReader(data)
+	} else {
+		body = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := doWithRateLimit(c.HTTPClient, c.Logger, req, c.MaxRetryAfter)
+	requestID := req.Header.Get(requestIDHeader)
+	if err != nil {
+		return requestID, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return requestID, &APIError{StatusCode: resp.StatusCode, RequestID: requestID}
+	}
+	if out == nil {
+		return requestID, nil
+	}
+	return requestID, json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *SDMClient) recordRequestID(ctx context.Context, deviceID, requestID string) {
+	if c.Redis == nil || requestID == "" {
+		return
+	}
+	key := fmt.Sprintf("nest:%s:request_ids", deviceID)
+	c.Redis.LPush(ctx, key, requestID)
+	c.Redis.LTrim(ctx, key, 0, deviceRequestIDsLen-1)
+}
@@ -0,0 +1,265 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const testProjectID = "test-project"
+
+// MockThermostatClient is a ThermostatClient that serves fixtures and records
+// the commands it is sent.
+type MockThermostatClient struct {
+	mu sync.Mutex
+	// Devices is returned by FetchDevices, and looked up by FetchDevice.
+	Devices []Device
+	// FetchDevicesFunc, if set, replaces FetchDevices.
+	FetchDevicesFunc func(ctx context.Context, token string) ([]Device, error)
+	// CommandErr is returned by every ExecuteCommand.
+	CommandErr error
+	// Commands are the commands sent, oldest first.
+	Commands []MockCommand
+	// Fetches counts FetchDevices calls.
+	Fetches int
+}
+
+// MockCommand is a command sent to a MockThermostatClient.
+type MockCommand struct {
+	DeviceName string
+	Command    string
+	Params     map[string]any
+}
+
+func (c *MockThermostatClient) FetchDevices(ctx context.Context, token string) ([]Device, error) {
+	c.mu.Lock()
+	c.Fetches++
+	fn := c.FetchDevicesFunc
+	devices := c.Devices
+	c.mu.Unlock()
+	if fn != nil {
+		return fn(ctx, token)
+	}
+	return devices, nil
+}
+
+func (c *MockThermostatClient) FetchDevice(ctx context.Context, token, deviceName string) (Device, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, d := range c.Devices {
+		if d.Name == deviceName {
+			return d, nil
+		}
+	}
+	return Device{}, fmt.Errorf("%s: %w", deviceName, &APIError{StatusCode: http.StatusNotFound})
+}
+
+func (c *MockThermostatClient) ExecuteCommand(ctx context.Context, token, deviceName, command string, params map[string]any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Commands = append(c.Commands, MockCommand{DeviceName: deviceName, Command: command, Params: params})
+	return c.CommandErr
+}
+
+// commands returns a copy of the commands sent so far.
+func (c *MockThermostatClient) commands() []MockCommand {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]MockCommand(nil), c.Commands...)
+}
+
+// recordingNotifier keeps every alert it is sent.
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []AlertEvent
+}
+
+func (n *recordingNotifier) Name() string {
+	return "recording"
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, event AlertEvent) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, event)
+	return nil
+}
+
+// ofType returns the alerts of alertType sent so far.
+func (n *recordingNotifier) ofType(alertType string) []AlertEvent {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var events []AlertEvent
+	for _, e := range n.events {
+		if e.Type == alertType {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// testConfig returns a config with defaults filled in, as LoadConfig would,
+// with fields overridden by their JSON names.
+func testConfig(t testing.TB, fields map[string]any) *Config {
+	t.Helper()
+	obj := map[string]any{"project_id": testProjectID}
+	for k, v := range fields {
+		obj[k] = v
+	}
+	cfg, err := decodeConfig(obj)
+	if err != nil {
+		t.Fatalf("decodeConfig: %v", err)
+	}
+	return cfg
+}
+
+// testMonitor is a Monitor wired to miniredis, a MockThermostatClient and a
+// recordingNotifier.
+type testMonitor struct {
+	*Monitor
+	redis    *miniredis.Miniredis
+	client   *MockThermostatClient
+	notifier *recordingNotifier
+}
+
+func newTestMonitor(t testing.TB, cfg *Config, client *MockThermostatClient, opts ...Option) *testMonitor {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	if client == nil {
+		client = &MockThermostatClient{}
+	}
+	notifier := &recordingNotifier{}
+	opts = append([]Option{
+		WithConfig(cfg),
+		WithRedisClient(rdb),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithThermostatClient(client),
+		WithNotifiers(notifier),
+	}, opts...)
+	m, err := NewMonitor(opts...)
+	if err != nil {
+		t.Fatalf("NewMonitor: %v", err)
+	}
+	return &testMonitor{Monitor: m, redis: mr, client: client, notifier: notifier}
+}
+
+// testDevice returns a Celsius thermostat in HEAT mode, parsed from SDM
+// traits as FetchDevices would return it.
+func testDevice(t testing.TB, id string, ambientC float64, hvacStatus string, heatC float64) Device {
+	t.Helper()
+	raw := func(v any) json.RawMessage {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	d, err := UnmarshalDevice(map[string]json.RawMessage{
+		"deviceName":                                       raw(fmt.Sprintf("enterprises/%s/devices/%s", testProjectID, id)),
+		"deviceType":                                       raw("sdm.devices.types.THERMOSTAT"),
+		"sdm.devices.traits.Info":                          raw(map[string]string{"customName": id}),
+		"sdm.devices.traits.Connectivity":                  raw(map[string]string{"status": "ONLINE"}),
+		"sdm.devices.traits.Settings":                      raw(map[string]string{"displayTemperatureUnit": "CELSIUS"}),
+		"sdm.devices.traits.Temperature":                   raw(map[string]float64{"ambientTemperatureCelsius": ambientC}),
+		"sdm.devices.traits.ThermostatHvac":                raw(map[string]string{"status": hvacStatus}),
+		"sdm.devices.traits.ThermostatMode":                raw(map[string]any{"mode": "HEAT", "availableModes": []string{"HEAT", "COOL", "HEATCOOL", "OFF"}}),
+		"sdm.devices.traits.ThermostatTemperatureSetpoint": raw(map[string]float64{"heatCelsius": heatC}),
+	})
+	if err != nil {
+		t.Fatalf("UnmarshalDevice: %v", err)
+	}
+	return *d
+}
+
+// seedSamples stores samples, newest first, as earlier polls would have.
+func (tm *testMonitor) seedSamples(t testing.TB, deviceID string, samples ...Sample) {
+	t.Helper()
+	ctx := context.Background()
+	for i := len(samples) - 1; i >= 0; i-- {
+		data, err := encodeSample(tm.config().RedisSampleEncoding, samples[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tm.rdb.LPush(ctx, samplesKey(deviceID), data).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// storedSamples returns the device's stored samples, newest first.
+func (tm *testMonitor) storedSamples(t testing.TB, deviceID string) []Sample {
+	t.Helper()
+	raw, err := tm.rdb.LRange(context.Background(), samplesKey(deviceID), 0, -1).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decodeSamples(raw)
+}
+
+// minutesAgo is a sample timestamp n minutes before now.
+func minutesAgo(n int) time.Time {
+	return time.Now().Add(-time.Duration(n) * time.Minute).Truncate(time.Second)
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// jsonResponse answers every request with status and body.
+func jsonResponse(status int, body string) *http.Client {
+	return &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	})}
+}
+
+func TestFetchDevicesSkipsMalformedDevice(t *testing.T) {
+	client := &SDMClient{
+		ProjectID: testProjectID,
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		HTTPClient: jsonResponse(http.StatusOK, `{"devices": [
+			{"name": "enterprises/test-project/devices/good", "traits": {"sdm.devices.traits.Temperature": {"ambientTemperatureCelsius": 20}}},
+			{"name": "enterprises/test-project/devices/bad", "traits": {"sdm.devices.traits.Temperature": {"ambientTemperatureCelsius": "n/a"}}}
+		]}`),
+	}
+
+	devices, err := client.FetchDevices(context.Background(), "token")
+	if err != nil {
+		t.Fatalf("FetchDevices: %v", err)
+	}
+	if len(devices) != 1 || devices[0].ID != "good" || devices[0].Ambient != 20 {
+		t.Errorf("FetchDevices = %+v, want only the good device", devices)
+	}
+}
+
+func TestFetchDeviceMalformed(t *testing.T) {
+	client := &SDMClient{
+		ProjectID:  testProjectID,
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		HTTPClient: jsonResponse(http.StatusOK, `{"name": "enterprises/test-project/devices/bad", "traits": {"sdm.devices.traits.ThermostatHvac": {"status": 1}}}`),
+	}
+
+	_, err := client.FetchDevice(context.Background(), "token", "enterprises/test-project/devices/bad")
+	if !errors.Is(err, errMalformedDevice) {
+		t.Errorf("FetchDevice error = %v, want errMalformedDevice", err)
+	}
+}
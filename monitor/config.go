@@ -0,0 +1,708 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+type Config struct {
+	ClientID         string `json:"client_id"`
+	ClientSecret     string `json:"client_secret"`
+	ClientSecretFile string `json:"client_secret_file"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshTokenFile string `json:"refresh_token_file"`
+	// ServiceAccountKeyFile, if set, is used to get access tokens instead of
+	// client_id, client_secret and refresh_token.
+	ServiceAccountKeyFile string `json:"service_account_key_file"`
+	ProjectID             string `json:"project_id" jsonschema:"required"`
+	// ConfigOverlay names a file merged on top of this one, relative to this
+	// file's directory, so secrets can be kept out of it.
+	ConfigOverlay                string            `json:"config_overlay"`
+	MaxTokenRefreshRetries       int               `json:"max_token_refresh_retries"`
+	TokenRetryBackoffBaseSeconds int               `json:"token_retry_backoff_base_seconds"`
+	MaxRetryAfterSeconds         int               `json:"max_retry_after_seconds"`
+	PushoverUser                 string            `json:"pushover_user"`
+	PushoverToken                string            `json:"pushover_token"`
+	PushoverTokenFile            string            `json:"pushover_token_file"`
+	PushoverAppTitle             string            `json:"pushover_app_title"`
+	PushoverMonthlyQuotaLimit    int               `json:"pushover_monthly_quota_limit"`
+	AlertTitleSuffixes           map[string]string `json:"alert_title_suffixes"`
+
+	DiscordWebhookURL    string           `json:"discord_webhook_url"`
+	PublishAlertsToRedis bool             `json:"publish_alerts_to_redis"`
+	RedisPubSubChannel   string           `json:"redis_pubsub_channel"`
+	SMTPHost             string           `json:"smtp_host"`
+	SMTPPort             int              `json:"smtp_port"`
+	SMTPUsername         string           `json:"smtp_username"`
+	SMTPPassword         string           `json:"smtp_password"`
+	EmailFrom            string           `json:"email_from"`
+	EmailTo              []string         `json:"email_to"`
+	PagerDutyRoutingKey  string           `json:"pagerduty_routing_key"`
+	EscalationChain      []EscalationStep `json:"escalation_chain"`
+
+	DeviceAliases    map[string]string           `json:"device_aliases"`
+	DeviceGroups     []DeviceGroup               `json:"device_groups"`
+	DeviceThresholds map[string]DeviceThresholds `json:"device_thresholds"`
+	AlertPriorities  map[string]string           `json:"alert_priorities"`
+	// AlertMaxRetries is how many times a failed notifier is retried.
+	AlertMaxRetries int `json:"alert_max_retries"`
+	// AlertRetrySeconds and AlertExpireSeconds set, per alert type, how
+	// often Pushover repeats an emergency alert until it is acknowledged and
+	// when it gives up.
+	AlertRetrySeconds  map[string]int `json:"alert_retry_seconds"`
+	AlertExpireSeconds map[string]int `json:"alert_expire_seconds"`
+
+	// RedisMode is "standalone" (the default), which connects to
+	// redis_addr, or "sentinel", which asks sentinel_addrs for the current
+	// master of sentinel_master_name. RedisPassword is the master's
+	// password; SentinelPassword is the sentinels' own, if they need one.
+	RedisMode          string   `json:"redis_mode"`
+	RedisPassword      string   `json:"redis_password"`
+	SentinelMasterName string   `json:"sentinel_master_name"`
+	SentinelAddrs      []string `json:"sentinel_addrs"`
+	SentinelPassword   string   `json:"sentinel_password"`
+
+	RedisAddr                    string `json:"redis_addr"`
+	RedisReconnectTimeoutSeconds int    `json:"redis_reconnect_timeout_seconds"`
+	RedisSampleEncoding          string `json:"redis_sample_encoding"`
+	DeviceCacheTTLMinutes        int    `json:"device_cache_ttl_minutes"`
+	MaxConcurrentDevices         int    `json:"max_concurrent_devices"`
+	// DeviceProcessTimeoutSeconds bounds the time spent on one device per
+	// poll.
+	DeviceProcessTimeoutSeconds int `json:"device_process_timeout_seconds"`
+
+	SuppressAlertsWhenUnoccupied bool `json:"suppress_alerts_when_unoccupied"`
+	// AutoRestore turns a thermostat the monitor shut off back on once its
+	// trend clears, or once ambient is back within RecoveryThresholdF of
+	// its saved setpoints during the RestoreAfterMinutes window.
+	AutoRestore            bool    `json:"auto_restore"`
+	RestoreAfterMinutes    int     `json:"restore_after_minutes"`
+	RecoveryThresholdF     float64 `json:"recovery_threshold_f"`
+	EmptyDeviceListRetries int     `json:"empty_device_list_retries"`
+
+	SampleWindow int `json:"sample_window"`
+	// TrendSlopeThreshold, in °F per minute whatever the device's display
+	// unit, and TrendR2Threshold are what a trend across the sample window
+	// must exceed to alert.
+	TrendSlopeThreshold float64 `json:"trend_slope_threshold"`
+	TrendR2Threshold    float64 `json:"trend_r2_threshold"`
+	// SingleCycleDropThresholdF is how far, in °F, ambient may fall between
+	// two polls while heating before it is alerted on at once.
+	SingleCycleDropThresholdF float64 `json:"single_cycle_drop_threshold_f"`
+	// AlertHysteresisF is how far, in °F, a reading must come back inside a
+	// threshold before an active alert clears.
+	AlertHysteresisF          float64 `json:"alert_hysteresis_f"`
+	PollIntervalMinutes       int     `json:"poll_interval_minutes"`
+	DeviceSilenceAlertMinutes int     `json:"device_silence_alert_minutes"`
+	MaxSampleAgeMinutes       int     `json:"max_sample_age_minutes"`
+	// DeviceErrorAlertThreshold is how many polls in a row a device must
+	// fail to process before it is alerted on.
+	DeviceErrorAlertThreshold    int             `json:"device_error_alert_threshold"`
+	AlertOnNewDevice             bool            `json:"alert_on_new_device"`
+	DailyFanRuntimeAlertHours    float64         `json:"daily_fan_runtime_alert_hours"`
+	ForceUnit                    string          `json:"force_unit"`
+	RetentionDays                int             `json:"retention_days"`
+	HistoricalDeviationThreshold float64         `json:"historical_deviation_threshold"`
+	SetpointBounds               *SetpointBounds `json:"setpoint_bounds"`
+	// SetpointGuardMinHeatF and SetpointGuardMaxCoolF are the bounds the
+	// setpoint guard enforces, in °F; zero leaves that setpoint unguarded.
+	SetpointGuardMinHeatF    float64            `json:"setpoint_guard_min_heat_f"`
+	SetpointGuardMaxCoolF    float64            `json:"setpoint_guard_max_cool_f"`
+	SeasonalModeRules        []SeasonalModeRule `json:"seasonal_mode_rules"`
+	AlertOnScheduleDeviation bool               `json:"alert_on_schedule_deviation"`
+	// SetpointDeviationThreshold is how far, in °F, ambient may be past a
+	// scheduled setpoint before a schedule_deviation alert.
+	SetpointDeviationThreshold float64 `json:"setpoint_deviation_threshold"`
+	// Timezone is the IANA time zone, e.g. America/Chicago, that schedules,
+	// seasons and daily keys are read in. Empty means the server's.
+	Timezone string `json:"timezone"`
+
+	PubSubSubscription         string `json:"pubsub_subscription"`
+	PubSubRefreshMinutes       int    `json:"pubsub_refresh_minutes"`
+	HealthCheckIntervalSeconds int    `json:"health_check_interval_seconds"`
+	WatchdogTimeoutSeconds     int    `json:"watchdog_timeout_seconds"`
+	PubSubPushAudience         string `json:"pubsub_push_audience"`
+	PubSubPushServiceAccount   string `json:"pubsub_push_service_account"`
+
+	AdminToken             string `json:"admin_token"`
+	LogHTTPRequests        bool   `json:"log_http_requests"`
+	PrometheusSnapshotPath string `json:"prometheus_snapshot_path"`
+	// GRPCCertFile and GRPCKeyFile are the gRPC server's TLS certificate and
+	// key. With GRPCClientCAFile set, clients need a certificate it signed.
+	GRPCCertFile     string `json:"grpc_cert_file"`
+	GRPCKeyFile      string `json:"grpc_key_file"`
+	GRPCClientCAFile string `json:"grpc_client_ca_file"`
+
+	ReportOutputPath string `json:"report_output_path"`
+	ReportFormat     string `json:"report_format"`
+	ReportSchedule   string `json:"report_schedule"`
+	S3Bucket         string `json:"s3_bucket"`
+	S3Key            string `json:"s3_key"`
+
+	// AuditEnabled records every command sent to a thermostat in the
+	// audit_backend log: "file" (audit_file_path), "redis" (a stream) or
+	// "s3" (one object per command under audit_s3_prefix).
+	AuditEnabled     bool   `json:"audit_enabled"`
+	AuditBackend     string `json:"audit_backend"`
+	AuditFilePath    string `json:"audit_file_path"`
+	AuditRedisStream string `json:"audit_redis_stream"`
+	AuditS3Bucket    string `json:"audit_s3_bucket"`
+	AuditS3Prefix    string `json:"audit_s3_prefix"`
+
+	// location is Timezone, loaded by decodeConfig.
+	location *time.Location
+}
+
+// Alert types, used as keys in Config.AlertPriorities.
+const (
+	AlertCoolingRising  = "cooling_rising"
+	AlertHeatingFalling = "heating_falling"
+	AlertTurnOffSuccess = "turn_off_success"
+	AlertTurnOffFailed  = "turn_off_failed"
+	AlertTurnOnSuccess  = "turn_on_success"
+	AlertTurnOnFailed   = "turn_on_failed"
+	AlertTokenError     = "token_error"
+	AlertFetchError     = "fetch_error"
+	AlertNoDevices      = "no_devices"
+	AlertRedisError     = "redis_error"
+	AlertConfigError    = "config_error"
+
+	AlertSetpointOutOfBounds = "setpoint_out_of_bounds"
+	AlertSeasonalMode        = "seasonal_mode"
+	AlertLockSuccess         = "lock_success"
+	AlertUnlockSuccess       = "unlock_success"
+	AlertLockFailed          = "lock_failed"
+	AlertDeviceSilent        = "device_silent"
+	AlertScheduleDeviation   = "schedule_deviation"
+	AlertHealthCheckFailed   = "health_check_failed"
+	AlertHealthRecovered     = "health_recovered"
+	AlertDeviceError         = "device_error"
+	AlertSetpointGuard       = "setpoint_guard"
+	AlertSuddenDrop          = "sudden_drop"
+	AlertNewDevice           = "new_device"
+	AlertEmergencyShutoff    = "emergency_shutoff"
+	AlertFanRuntime          = "fan_runtime"
+	AlertAuditFailed         = "audit_failed"
+)
+
+const defaultAlertPriority = "0"
+
+// Pushover's retry and expire for emergency alerts when not configured per
+// type, and the limits it accepts.
+const (
+	defaultAlertRetrySeconds  = 60
+	defaultAlertExpireSeconds = 3600
+	minAlertRetrySeconds      = 30
+	maxAlertExpireSeconds     = 10800
+)
+
+var defaultAlertPriorities = map[string]string{
+	AlertCoolingRising:     "2",
+	AlertHeatingFalling:    "2",
+	AlertLockFailed:        "1",
+	AlertDeviceSilent:      "1",
+	AlertSetpointGuard:     "1",
+	AlertSuddenDrop:        "1",
+	AlertEmergencyShutoff:  "1",
+	AlertAuditFailed:       "1",
+	AlertHealthCheckFailed: "-1",
+	AlertHealthRecovered:   "-1",
+	AlertNewDevice:         "-1",
+}
+
+// unoccupiedPriority caps the priority of alerts that are less urgent when
+// nobody is home: trend alerts drop to high priority and setpoint alerts to
+// normal. Other alerts keep their priority.
+func unoccupiedPriority(alertType, priority string) string {
+	var limit int
+	switch alertType {
+	case AlertCoolingRising, AlertHeatingFalling:
+		limit = 1
+	case AlertSetpointOutOfBounds:
+		limit = 0
+	default:
+		return priority
+	}
+	if p, err := strconv.Atoi(priority); err == nil && p <= limit {
+		return priority
+	}
+	return strconv.Itoa(limit)
+}
+
+// maxSampleGap is the longest gap between samples that still counts as
+// consecutive readings.
+func (c *Config) maxSampleGap() time.Duration {
+	return 2 * time.Duration(c.PollIntervalMinutes) * time.Minute
+}
+
+// forcedUnit returns the SDM unit name all temperatures are converted to, or
+// "" to keep each device's display unit.
+func (c *Config) forcedUnit() string {
+	switch c.ForceUnit {
+	case "F":
+		return "FAHRENHEIT"
+	case "C":
+		return "CELSIUS"
+	}
+	return ""
+}
+
+// Location is the configured time zone, or the server's if none is set.
+func (c *Config) Location() *time.Location {
+	if c.location != nil {
+		return c.location
+	}
+	return time.Local
+}
+
+// now is the current time in the configured time zone.
+func (c *Config) now() time.Time {
+	return time.Now().In(c.Location())
+}
+
+const defaultAppTitle = "Nest Alert"
+
+// AlertTitle returns the notification title for alertType:
+// PushoverAppTitle, followed by ": " and the type's suffix from
+// AlertTitleSuffixes if it has one.
+func (c *Config) AlertTitle(alertType string) string {
+	title := defaultAppTitle
+	if c == nil {
+		return title
+	}
+	if c.PushoverAppTitle != "" {
+		title = c.PushoverAppTitle
+	}
+	if suffix := c.AlertTitleSuffixes[alertType]; suffix != "" {
+		title += ": " + suffix
+	}
+	return title
+}
+
+// AlertPriority returns the Pushover priority configured for alertType.
+func (c *Config) AlertPriority(alertType string) string {
+	if c != nil {
+		if p, ok := c.AlertPriorities[alertType]; ok {
+			return p
+		}
+	}
+	if p, ok := defaultAlertPriorities[alertType]; ok {
+		return p
+	}
+	return defaultAlertPriority
+}
+
+// AlertRetry returns the Pushover retry interval, in seconds, for
+// emergency alerts of the given type.
+func (c *Config) AlertRetry(alertType string) int {
+	if s, ok := c.AlertRetrySeconds[alertType]; ok {
+		return s
+	}
+	return defaultAlertRetrySeconds
+}
+
+// AlertExpire returns how long, in seconds, Pushover keeps retrying
+// emergency alerts of the given type.
+func (c *Config) AlertExpire(alertType string) int {
+	if s, ok := c.AlertExpireSeconds[alertType]; ok {
+		return s
+	}
+	return defaultAlertExpireSeconds
+}
+
+// LoadConfig reads the config at path. If it sets config_overlay, that file
+// is merged on top of it.
+func LoadConfig(path string) (*Config, error) {
+	obj, err := readConfigObject(path)
+	if err != nil {
+		return nil, err
+	}
+	if overlay, _ := obj["config_overlay"].(string); overlay != "" {
+		return loadConfigWithOverlay(path, overlayPath(path, overlay))
+	}
+	return decodeConfig(obj)
+}
+
+// decodeConfig turns a config read as a JSON object into a Config, reading
+// secret files and filling in defaults.
+func decodeConfig(obj map[string]any) (*Config, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.readSecretFiles(); err != nil {
+		return nil, err
+	}
+	if cfg.Timezone != "" {
+		// An unknown zone is reported by ValidationErrors.
+		cfg.location, _ = time.LoadLocation(cfg.Timezone)
+	}
+	cfg.setDefaults()
+	return &cfg, nil
+}
+
+// readSecretFiles fills secrets from their *_file counterparts, as mounted by
+// Docker or Kubernetes secrets. Setting both a secret and its file is an
+// error.
+func (c *Config) readSecretFiles() error {
+	secrets := []struct {
+		name, fileName string
+		value          *string
+		path           string
+	}{
+		{"client_secret", "client_secret_file", &c.ClientSecret, c.ClientSecretFile},
+		{"refresh_token", "refresh_token_file", &c.RefreshToken, c.RefreshTokenFile},
+		{"pushover_token", "pushover_token_file", &c.PushoverToken, c.PushoverTokenFile},
+	}
+	for _, s := range secrets {
+		if s.path == "" {
+			continue
+		}
+		if *s.value != "" {
+			return fmt.Errorf("only one of %s and %s may be set", s.name, s.fileName)
+		}
+		data, err := os.ReadFile(s.path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.fileName, err)
+		}
+		*s.value = strings.TrimSpace(string(data))
+	}
+	return nil
+}
+
+func (c *Config) setDefaults() {
+	if c.RedisAddr == "" {
+		c.RedisAddr = "localhost:6379"
+	}
+	if c.RedisMode == "" {
+		c.RedisMode = redisModeStandalone
+	}
+	if c.RedisPubSubChannel == "" {
+		c.RedisPubSubChannel = "nest:alerts"
+	}
+	if c.AuditBackend == "" {
+		c.AuditBackend = auditBackendFile
+	}
+	if c.AuditRedisStream == "" {
+		c.AuditRedisStream = "nest:audit"
+	}
+	if c.PushoverMonthlyQuotaLimit <= 0 {
+		c.PushoverMonthlyQuotaLimit = 9000
+	}
+	if c.DeviceCacheTTLMinutes <= 0 {
+		c.DeviceCacheTTLMinutes = 60
+	}
+	// Only an unset value gets the default, so Validate can reject negatives.
+	if c.MaxTokenRefreshRetries == 0 {
+		c.MaxTokenRefreshRetries = 3
+	}
+	if c.TokenRetryBackoffBaseSeconds <= 0 {
+		c.TokenRetryBackoffBaseSeconds = 1
+	}
+	if c.MaxRetryAfterSeconds <= 0 {
+		c.MaxRetryAfterSeconds = 60
+	}
+	if c.RedisSampleEncoding == "" {
+		c.RedisSampleEncoding = encodingJSON
+	}
+	if c.RedisReconnectTimeoutSeconds <= 0 {
+		c.RedisReconnectTimeoutSeconds = 30
+	}
+	if c.EmptyDeviceListRetries <= 0 {
+		c.EmptyDeviceListRetries = 3
+	}
+	if c.MaxConcurrentDevices <= 0 {
+		c.MaxConcurrentDevices = 4
+	}
+	if c.RetentionDays <= 0 {
+		c.RetentionDays = 7
+	}
+	if c.PollIntervalMinutes <= 0 {
+		c.PollIntervalMinutes = 10
+	}
+	if c.DeviceSilenceAlertMinutes <= 0 {
+		c.DeviceSilenceAlertMinutes = 60
+	}
+	if c.MaxSampleAgeMinutes <= 0 {
+		c.MaxSampleAgeMinutes = 3 * c.PollIntervalMinutes
+	}
+	if c.SetpointDeviationThreshold <= 0 {
+		c.SetpointDeviationThreshold = 2
+	}
+	if c.SampleWindow <= 0 {
+		c.SampleWindow = 3
+	}
+	if c.PubSubRefreshMinutes <= 0 {
+		c.PubSubRefreshMinutes = 30
+	}
+	if c.HealthCheckIntervalSeconds <= 0 {
+		c.HealthCheckIntervalSeconds = 60
+	}
+	if c.TrendSlopeThreshold <= 0 {
+		c.TrendSlopeThreshold = 0.02
+	}
+	if c.DeviceProcessTimeoutSeconds <= 0 {
+		c.DeviceProcessTimeoutSeconds = 60
+	}
+	if c.SingleCycleDropThresholdF <= 0 {
+		c.SingleCycleDropThresholdF = 8
+	}
+	if c.AlertHysteresisF <= 0 {
+		c.AlertHysteresisF = 1
+	}
+	if c.TrendR2Threshold <= 0 {
+		c.TrendR2Threshold = 0.8
+	}
+	if c.DeviceErrorAlertThreshold <= 0 {
+		c.DeviceErrorAlertThreshold = 3
+	}
+	if c.AlertMaxRetries == 0 {
+		c.AlertMaxRetries = 2
+	}
+	if c.RestoreAfterMinutes <= 0 {
+		c.RestoreAfterMinutes = 60
+	}
+	if c.RecoveryThresholdF <= 0 {
+		c.RecoveryThresholdF = 2
+	}
+	if c.SMTPPort <= 0 {
+		c.SMTPPort = 587
+	}
+	for i := range c.EscalationChain {
+		if c.EscalationChain[i].Condition == "" {
+			c.EscalationChain[i].Condition = escalateIfUnacknowledged
+		}
+	}
+	if c.ReportFormat == "" {
+		c.ReportFormat = "json"
+	}
+}
+
+func (c *Config) Validate() error {
+	if errs := c.ValidationErrors(); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// ValidationErrors returns every problem that makes the config unusable, in
+// the order Validate checks them.
+func (c *Config) ValidationErrors() []error {
+	var errs []error
+	required := []struct{ name, value string }{
+		{"client_id", c.ClientID},
+		{"client_secret", c.ClientSecret},
+		{"refresh_token", c.RefreshToken},
+		{"project_id", c.ProjectID},
+	}
+	if c.ServiceAccountKeyFile != "" {
+		// The service account key replaces the OAuth client credentials.
+		required = required[3:]
+	}
+	for _, f := range required {
+		if f.value == "" {
+			errs = append(errs, fmt.Errorf("%s is required", f.name))
+		}
+	}
+	for alertType, p := range c.AlertPriorities {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < -2 || n > 2 {
+			errs = append(errs, fmt.Errorf("alert_priorities[%s]: %q is not a Pushover priority (-2 to 2)", alertType, p))
+		}
+	}
+	for alertType, s := range c.AlertRetrySeconds {
+		if s < minAlertRetrySeconds {
+			errs = append(errs, fmt.Errorf("alert_retry_seconds[%s]: Pushover needs at least %d, got %d", alertType, minAlertRetrySeconds, s))
+		}
+	}
+	for alertType, s := range c.AlertExpireSeconds {
+		if s <= 0 || s > maxAlertExpireSeconds {
+			errs = append(errs, fmt.Errorf("alert_expire_seconds[%s]: must be between 1 and %d, got %d", alertType, maxAlertExpireSeconds, s))
+		}
+	}
+	if c.ForceUnit != "" && c.ForceUnit != "F" && c.ForceUnit != "C" {
+		errs = append(errs, fmt.Errorf("force_unit must be F or C, got %q", c.ForceUnit))
+	}
+	if (c.GRPCCertFile == "") != (c.GRPCKeyFile == "") {
+		errs = append(errs, fmt.Errorf("grpc_cert_file and grpc_key_file must be set together"))
+	}
+	if c.GRPCClientCAFile != "" && c.GRPCCertFile == "" {
+		errs = append(errs, fmt.Errorf("grpc_client_ca_file needs grpc_cert_file and grpc_key_file"))
+	}
+	switch c.RedisMode {
+	case redisModeStandalone:
+	case redisModeSentinel:
+		if c.SentinelMasterName == "" || len(c.SentinelAddrs) == 0 {
+			errs = append(errs, fmt.Errorf("redis_mode sentinel needs sentinel_master_name and sentinel_addrs"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("redis_mode must be standalone or sentinel, got %q", c.RedisMode))
+	}
+	if c.AuditEnabled {
+		switch c.AuditBackend {
+		case auditBackendFile:
+			if c.AuditFilePath == "" {
+				errs = append(errs, fmt.Errorf("audit_backend file needs audit_file_path"))
+			}
+		case auditBackendRedis:
+		case auditBackendS3:
+			if c.AuditS3Bucket == "" {
+				errs = append(errs, fmt.Errorf("audit_backend s3 needs audit_s3_bucket"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("audit_backend must be file, redis or s3, got %q", c.AuditBackend))
+		}
+	}
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			errs = append(errs, fmt.Errorf("timezone: %w", err))
+		}
+	}
+	if c.RedisSampleEncoding != encodingJSON && c.RedisSampleEncoding != encodingMsgpack {
+		errs = append(errs, fmt.Errorf("redis_sample_encoding must be json or msgpack, got %q", c.RedisSampleEncoding))
+	}
+	if c.MaxTokenRefreshRetries < 1 || c.MaxTokenRefreshRetries > 10 {
+		errs = append(errs, fmt.Errorf("max_token_refresh_retries must be between 1 and 10, got %d", c.MaxTokenRefreshRetries))
+	}
+	if c.SampleWindow < 2 {
+		errs = append(errs, fmt.Errorf("sample_window must be at least 2, got %d", c.SampleWindow))
+	}
+	if c.SetpointGuardMinHeatF != 0 && c.SetpointGuardMaxCoolF != 0 && c.SetpointGuardMinHeatF >= c.SetpointGuardMaxCoolF {
+		errs = append(errs, fmt.Errorf("setpoint_guard_min_heat_f (%.1f) must be below setpoint_guard_max_cool_f (%.1f)", c.SetpointGuardMinHeatF, c.SetpointGuardMaxCoolF))
+	}
+	if c.TrendR2Threshold >= 1 {
+		errs = append(errs, fmt.Errorf("trend_r2_threshold must be below 1, got %g", c.TrendR2Threshold))
+	}
+	if c.WatchdogTimeoutSeconds > 0 && time.Duration(c.WatchdogTimeoutSeconds)*time.Second <= pubSubPullTimeout {
+		errs = append(errs, fmt.Errorf("watchdog_timeout_seconds must be more than the %d-second Pub/Sub pull timeout, got %d", int(pubSubPullTimeout.Seconds()), c.WatchdogTimeoutSeconds))
+	}
+	if err := validateSeasonalRules(c.SeasonalModeRules); err != nil {
+		errs = append(errs, err)
+	}
+	if b := c.SetpointBounds; b != nil && b.Min >= b.Max {
+		errs = append(errs, fmt.Errorf("setpoint_bounds: min (%.1f) must be below max (%.1f)", b.Min, b.Max))
+	}
+	if err := validateDeviceGroups(c.DeviceGroups, c.DeviceThresholds); err != nil {
+		errs = append(errs, err)
+	}
+	if c.SMTPHost != "" && (c.EmailFrom == "" || len(c.EmailTo) == 0) {
+		errs = append(errs, fmt.Errorf("smtp_host needs email_from and email_to"))
+	}
+	if err := validateEscalationChain(c); err != nil {
+		errs = append(errs, err)
+	}
+	if c.ReportFormat != "json" && c.ReportFormat != "text" {
+		errs = append(errs, fmt.Errorf("report_format must be json or text, got %q", c.ReportFormat))
+	}
+	if c.S3Key != "" && c.S3Bucket == "" {
+		errs = append(errs, fmt.Errorf("s3_key needs s3_bucket"))
+	}
+	if c.ReportSchedule != "" {
+		if _, err := cron.ParseStandard(c.ReportSchedule); err != nil {
+			errs = append(errs, fmt.Errorf("report_schedule: %w", err))
+		}
+	}
+	return errs
+}
+
+// Warnings returns settings that are allowed but probably not intended.
+func (c *Config) Warnings() []string {
+	var warnings []string
+	if c.PushoverToken == "" && c.DiscordWebhookURL == "" && !c.PublishAlertsToRedis {
+		warnings = append(warnings, "no notifiers are configured, so alerts are only recorded in Redis")
+	}
+	if (c.PushoverUser == "") != (c.PushoverToken == "") {
+		warnings = append(warnings, "pushover_user and pushover_token must both be set for Pushover alerts")
+	}
+	if c.ReportSchedule != "" && c.ReportOutputPath == "" && c.S3Bucket == "" {
+		warnings = append(warnings, "report_schedule is set but neither report_output_path nor s3_bucket is, so scheduled reports will fail")
+	}
+	if c.AdminToken == "" {
+		warnings = append(warnings, "admin_token is not set, so DELETE /alerts is disabled")
+	}
+	return warnings
+}
+
+// Fields that are only read at startup; changing them needs a restart. The
+// SDM client and the notifiers copy theirs when NewMonitor builds them.
+var restartOnlyFields = []string{"RedisMode", "RedisAddr", "RedisPassword", "SentinelMasterName", "SentinelAddrs", "SentinelPassword", "RedisReconnectTimeoutSeconds", "ClientID", "ClientSecret", "RefreshToken", "ServiceAccountKeyFile", "ReportSchedule", "LogHTTPRequests", "WatchdogTimeoutSeconds", "GRPCCertFile", "GRPCKeyFile", "GRPCClientCAFile", "AuditEnabled", "AuditBackend", "AuditFilePath", "AuditRedisStream", "AuditS3Bucket", "AuditS3Prefix", "ProjectID", "MaxRetryAfterSeconds", "PushoverToken", "PushoverUser", "PushoverMonthlyQuotaLimit", "DiscordWebhookURL", "PublishAlertsToRedis", "RedisPubSubChannel"}
+
+// configStore holds the active config so long-running modes can pick up
+// changes without restarting.
+type configStore struct {
+	v atomic.Value // *Config
+}
+
+func newConfigStore(cfg *Config) *configStore {
+	s := &configStore{}
+	s.v.Store(cfg)
+	return s
+}
+
+func (s *configStore) Load() *Config {
+	return s.v.Load().(*Config)
+}
+
+// ReloadConfig swaps in the contents of the config file at path and returns
+// the names of the fields that changed. overrides are applied to the new
+// config before it is validated, e.g. to keep command-line flags that
+// override config fields in effect.
+func (m *Monitor) ReloadConfig(path string, overrides ...func(*Config)) ([]string, error) {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, override := range overrides {
+		override(cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	old := m.configs.Load()
+	oldV := reflect.ValueOf(old).Elem()
+	newV := reflect.ValueOf(cfg).Elem()
+	for _, name := range restartOnlyFields {
+		if !reflect.DeepEqual(oldV.FieldByName(name).Interface(), newV.FieldByName(name).Interface()) {
+			return nil, fmt.Errorf("%s cannot be changed without a restart", name)
+		}
+	}
+
+	m.configs.v.Store(cfg)
+	return changedFields(old, cfg), nil
+}
+
+// changedFields returns the JSON names of the fields that differ. Values are
+// not returned since several of them are secrets.
+func changedFields(a, b *Config) []string {
+	av := reflect.ValueOf(a).Elem()
+	bv := reflect.ValueOf(b).Elem()
+	t := av.Type()
+
+	var changed []string
+	for i := 0; i < t.NumField(); i++ {
+		if !t.Field(i).IsExported() {
+			continue
+		}
+		if !reflect.DeepEqual(av.Field(i).Interface(), bv.Field(i).Interface()) {
+			name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if name == "" {
+				name = t.Field(i).Name
+			}
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
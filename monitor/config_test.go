@@ -0,0 +1,171 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfig writes a config file that passes Validate, with fields
+// overridden by their JSON names, and returns its path.
+func writeConfig(t *testing.T, dir string, fields map[string]any) string {
+	t.Helper()
+	obj := map[string]any{
+		"project_id":    testProjectID,
+		"client_id":     "client",
+		"client_secret": "secret",
+		"refresh_token": "refresh",
+	}
+	for k, v := range fields {
+		obj[k] = v
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReloadConfigAppliesToNextPoll(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, map[string]any{"setpoint_guard_max_cool_f": 80})
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm := newTestMonitor(t, cfg, nil)
+
+	// Cooling to 25.5°C (77.9°F): within 80°F, above 75°F.
+	d := testDevice(t, "dev1", 26, "COOLING", 0)
+	d.Mode, d.Heat, d.Cool = "COOL", 0, 25.5
+	ctx := context.Background()
+
+	tm.processDevices(ctx, []Device{d}, "token")
+	if cmds := tm.client.commands(); len(cmds) != 0 {
+		t.Fatalf("sent commands %+v under the 80°F guard, want none", cmds)
+	}
+
+	writeConfig(t, dir, map[string]any{"setpoint_guard_max_cool_f": 75})
+	changed, err := tm.ReloadConfig(path)
+	if err != nil {
+		t.Fatalf("ReloadConfig: %v", err)
+	}
+	if len(changed) != 1 || changed[0] != "setpoint_guard_max_cool_f" {
+		t.Errorf("changed fields = %v, want [setpoint_guard_max_cool_f]", changed)
+	}
+
+	tm.processDevices(ctx, []Device{d}, "token")
+	cmds := tm.client.commands()
+	if len(cmds) != 1 || !strings.HasSuffix(cmds[0].Command, ".SetCool") {
+		t.Fatalf("sent commands %+v after reloading, want one SetCool", cmds)
+	}
+	if got, _ := cmds[0].Params["coolCelsius"].(float64); math.Abs(cToF(got)-75) > 0.01 {
+		t.Errorf("SetCool to %v°C (%.2f°F), want 75°F", got, cToF(got))
+	}
+}
+
+func TestReloadConfigRejectsRestartOnlyFields(t *testing.T) {
+	changes := map[string]any{
+		"redis_addr":              "redis.example:6379",
+		"project_id":              "other-project",
+		"pushover_token":          "new-token",
+		"discord_webhook_url":     "https://discord.com/api/webhooks/1/new",
+		"max_retry_after_seconds": 1,
+	}
+	for field, value := range changes {
+		t.Run(field, func(t *testing.T) {
+			dir := t.TempDir()
+			path := writeConfig(t, dir, nil)
+			cfg, err := LoadConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tm := newTestMonitor(t, cfg, nil)
+
+			writeConfig(t, dir, map[string]any{field: value})
+			if _, err := tm.ReloadConfig(path); err == nil || !strings.Contains(err.Error(), "restart") {
+				t.Errorf("ReloadConfig error = %v, want one asking for a restart", err)
+			}
+			if tm.config() != cfg {
+				t.Errorf("config was replaced despite the error")
+			}
+		})
+	}
+}
+
+func TestReloadConfigUpdatesTokenRetries(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, map[string]any{"max_token_refresh_retries": 3})
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm := newTestMonitor(t, cfg, nil)
+
+	writeConfig(t, dir, map[string]any{"max_token_refresh_retries": 5})
+	if _, err := tm.ReloadConfig(path); err != nil {
+		t.Fatalf("ReloadConfig: %v", err)
+	}
+	if got := tm.tokens.configs.Load().MaxTokenRefreshRetries; got != 5 {
+		t.Errorf("token manager sees max_token_refresh_retries %d, want 5", got)
+	}
+}
+
+func TestReloadConfigKeepsOverrides(t *testing.T) {
+	dir := t.TempDir()
+	path := writeConfig(t, dir, nil)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// As -force-unit and -export-prometheus-snapshot would.
+	override := func(c *Config) {
+		c.ForceUnit = "C"
+		c.PrometheusSnapshotPath = filepath.Join(dir, "metrics.prom")
+	}
+	override(cfg)
+	tm := newTestMonitor(t, cfg, nil)
+
+	writeConfig(t, dir, map[string]any{"alert_on_new_device": true})
+	changed, err := tm.ReloadConfig(path, override)
+	if err != nil {
+		t.Fatalf("ReloadConfig: %v", err)
+	}
+	if len(changed) != 1 || changed[0] != "alert_on_new_device" {
+		t.Errorf("changed fields = %v, want [alert_on_new_device]", changed)
+	}
+	got := tm.config()
+	if got.ForceUnit != "C" || got.PrometheusSnapshotPath != cfg.PrometheusSnapshotPath {
+		t.Errorf("after reload force_unit = %q, prometheus_snapshot_path = %q, want the overrides kept", got.ForceUnit, got.PrometheusSnapshotPath)
+	}
+}
+
+func TestWatchdogTimeoutMustExceedPullTimeout(t *testing.T) {
+	tests := []struct {
+		seconds int
+		valid   bool
+	}{
+		{0, true},
+		{60, false},
+		{120, false},
+		{180, true},
+	}
+	for _, tt := range tests {
+		cfg := testConfig(t, map[string]any{"client_id": "client", "client_secret": "secret", "refresh_token": "refresh", "watchdog_timeout_seconds": tt.seconds})
+		err := cfg.Validate()
+		if tt.valid && err != nil {
+			t.Errorf("watchdog_timeout_seconds %d: %v", tt.seconds, err)
+		}
+		if !tt.valid && (err == nil || !strings.Contains(err.Error(), "watchdog_timeout_seconds")) {
+			t.Errorf("watchdog_timeout_seconds %d: err = %v, want one about the pull timeout", tt.seconds, err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+)
+
+// sampleTable collects one row per device during a poll and prints them as
+// a table once the poll is done, for -debug-samples.
+type sampleTable struct {
+	w    io.Writer
+	mu   sync.Mutex
+	rows []sampleRow
+}
+
+type sampleRow struct {
+	name  string
+	d     Device
+	trend string
+}
+
+func (t *sampleTable) add(name string, d *Device, trend string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rows = append(t.rows, sampleRow{name: name, d: *d, trend: trend})
+}
+
+// flush prints the rows collected since the last flush, sorted by name.
+// Devices whose stored samples show a trend are marked [WOULD ALERT].
+func (t *sampleTable) flush() {
+	t.mu.Lock()
+	rows := t.rows
+	t.rows = nil
+	t.mu.Unlock()
+	sort.Slice(rows, func(i, j int) bool { return rows[i].name < rows[j].name })
+
+	tw := tabwriter.NewWriter(t.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DEVICE\tAMBIENT\tHEAT\tCOOL\tHVAC\tHUMIDITY\tCONNECTIVITY\t")
+	for _, r := range rows {
+		humidity := "-"
+		if r.d.Humidity != nil {
+			humidity = fmt.Sprintf("%.0f%%", *r.d.Humidity)
+		}
+		fmt.Fprintf(tw, "%s\t%.1f\t%s\t%s\t%s\t%s\t%s\t", r.name, r.d.Ambient, setpointCell(r.d.Heat), setpointCell(r.d.Cool), r.d.HvacState, humidity, r.d.Connectivity)
+		if r.trend != "" {
+			fmt.Fprintf(tw, "[WOULD ALERT] %s", r.trend)
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+}
+
+func setpointCell(v float64) string {
+	if v == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f", v)
+}
+
+// recordDebugSample adds d to the -debug-samples table, with the trend its
+// stored sample window shows, if any.
+func (m *Monitor) recordDebugSample(ctx context.Context, d *Device) {
+	window := int64(m.config().SampleWindow)
+	var trend string
+	raw, err := m.rdb.LRange(ctx, samplesKey(d.ID), 0, window-1).Result()
+	if err != nil {
+		m.logger.Warn("failed to read samples for the debug table", "device_id", d.ID, "err", err)
+	} else if samples := decodeSamples(raw); int64(len(samples)) >= window {
+		trend = detectTrend(samples, m.sampleUnit(d.ID), m.config())
+	}
+	m.debugSamples.add(m.displayName(d.ID), d, trend)
+}
@@ -0,0 +1,141 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Device is a device as returned by the SDM API, along with the trait values
+// the monitor uses. Temperatures are in the device's display unit.
+type Device struct {
+	Name   string                     `json:"name"`
+	Type   string                     `json:"type"`
+	Traits map[string]json.RawMessage `json:"traits"`
+
+	ID           string  `json:"-"`
+	CustomName   string  `json:"-"`
+	Connectivity string  `json:"-"`
+	Mode         string  `json:"-"`
+	HvacState    string  `json:"-"`
+	Unit         string  `json:"-"`
+	Ambient      float64 `json:"-"`
+	Heat         float64 `json:"-"`
+	Cool         float64 `json:"-"`
+	Room         string  `json:"-"`
+	// AvailableModes are the ThermostatMode values the device accepts.
+	AvailableModes []string `json:"-"`
+	// Occupied is nil when the device doesn't report occupancy.
+	Occupied *bool `json:"-"`
+	// Humidity is the ambient relative humidity, in percent, or nil when the
+	// device doesn't report it.
+	Humidity *float64 `json:"-"`
+	// FanTimerMode is the Fan trait's timerMode, ON or OFF, or "" when the
+	// device has no fan.
+	FanTimerMode string `json:"-"`
+	// Schedule is nil when the device doesn't report one.
+	Schedule *ThermostatSchedule `json:"-"`
+}
+
+// Sample is a single reading as stored in a device's Redis sample list.
+type Sample struct {
+	Ambient   float64   `json:"ambient"`
+	HvacState string    `json:"hvac_state"`
+	Heat      float64   `json:"heat"`
+	Cool      float64   `json:"cool"`
+	Ts        time.Time `json:"ts"`
+
+	Connectivity string `json:"connectivity,omitempty"`
+	Occupied     *bool  `json:"occupied,omitempty"`
+	FanTimerMode string `json:"fan_timer_mode,omitempty"`
+}
+
+func (d *Device) sample() Sample {
+	return Sample{
+		Ambient:   d.Ambient,
+		HvacState: d.HvacState,
+		Heat:      d.Heat,
+		Cool:      d.Cool,
+		Ts:        time.Now().Truncate(time.Second),
+
+		Connectivity: d.Connectivity,
+		Occupied:     d.Occupied,
+		FanTimerMode: d.FanTimerMode,
+	}
+}
+
+// traitMap returns the device's traits with its name added under
+// "deviceName" and its type under "deviceType", the shape UnmarshalDevice
+// expects.
+func (d *Device) traitMap() map[string]json.RawMessage {
+	traits := make(map[string]json.RawMessage, len(d.Traits)+2)
+	for k, v := range d.Traits {
+		traits[k] = v
+	}
+	traits["deviceName"] = json.RawMessage(fmt.Sprintf(`"%s"`, d.Name))
+	if d.Type != "" {
+		traits["deviceType"] = json.RawMessage(fmt.Sprintf(`"%s"`, d.Type))
+	}
+	return traits
+}
+
+// UnmarshalDevice parses a device's traits with DefaultTraitParser.
+func UnmarshalDevice(traits map[string]json.RawMessage) (*Device, error) {
+	return DefaultTraitParser.Parse(traits)
+}
+
+// deviceIDFromName returns the last path segment of a full device name
+// (enterprises/{project}/devices/{id}).
+func deviceIDFromName(name string) string {
+	parts := strings.Split(name, "/")
+	return parts[len(parts)-1]
+}
+
+func cToF(c float64) float64 {
+	return (c * 9 / 5) + 32
+}
+
+// forceUnit converts d's temperatures to unit, "FAHRENHEIT" or "CELSIUS",
+// if it isn't already displayed in that unit. It reports whether anything
+// changed.
+func (d *Device) forceUnit(unit string) bool {
+	from := d.Unit
+	if from == "" {
+		// The SDM API reports Celsius; without a Settings trait nothing was
+		// converted.
+		from = "CELSIUS"
+	}
+	if from == unit {
+		d.Unit = unit
+		return false
+	}
+	convert := cToF
+	if unit == "CELSIUS" {
+		convert = fToC
+	}
+	d.Ambient = convert(d.Ambient)
+	// Zero setpoints aren't in use and stay zero.
+	if d.Heat != 0 {
+		d.Heat = convert(d.Heat)
+	}
+	if d.Cool != 0 {
+		d.Cool = convert(d.Cool)
+	}
+	d.Unit = unit
+	return true
+}
+
+func fToC(f float64) float64 {
+	return (f - 32) * 5 / 9
+}
+
+// isPlausibleTemperature reports whether t, in unit, is within the range a
+// thermostat could actually read (-40 to 60 °C).
+func isPlausibleTemperature(t float64, unit string) bool {
+	lo, hi := -40.0, 60.0
+	if unit == "FAHRENHEIT" {
+		lo, hi = cToF(lo), cToF(hi)
+	}
+	return t >= lo && t <= hi
+}
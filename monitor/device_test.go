@@ -0,0 +1,60 @@
+package monitor
+
+import (
+	"math"
+	"testing"
+)
+
+// conversions are known Celsius/Fahrenheit pairs.
+var conversions = []struct {
+	name string
+	c, f float64
+}{
+	{"freezing", 0, 32},
+	{"boiling", 100, 212},
+	{"body temperature", 37, 98.6},
+	{"negative forty", -40, -40},
+	{"room temperature", 21, 69.8},
+	{"below freezing", -10, 14},
+}
+
+func TestCToF(t *testing.T) {
+	for _, tt := range conversions {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cToF(tt.c); math.Abs(got-tt.f) > 0.01 {
+				t.Errorf("cToF(%v) = %v, want %v", tt.c, got, tt.f)
+			}
+		})
+	}
+}
+
+func TestFToC(t *testing.T) {
+	for _, tt := range conversions {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fToC(tt.f); math.Abs(got-tt.c) > 0.01 {
+				t.Errorf("fToC(%v) = %v, want %v", tt.f, got, tt.c)
+			}
+		})
+	}
+}
+
+func TestConversionRoundTrip(t *testing.T) {
+	for c := -40.0; c <= 60; c += 0.5 {
+		if got := fToC(cToF(c)); math.Abs(got-c) > 0.01 {
+			t.Errorf("fToC(cToF(%v)) = %v", c, got)
+		}
+	}
+}
+
+func TestForceUnit(t *testing.T) {
+	d := Device{Unit: "CELSIUS", Ambient: 20, Heat: 21}
+	if !d.forceUnit("FAHRENHEIT") {
+		t.Fatal("forceUnit reported no change")
+	}
+	if d.Unit != "FAHRENHEIT" || math.Abs(d.Ambient-68) > 0.01 || math.Abs(d.Heat-69.8) > 0.01 || d.Cool != 0 {
+		t.Errorf("forced device = %+v, want 68°F ambient, 69.8°F heat and cool left at 0", d)
+	}
+	if d.forceUnit("FAHRENHEIT") {
+		t.Error("forceUnit to the current unit reported a change")
+	}
+}
@@ -0,0 +1,64 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const deviceCacheKey = "nest:devices:list"
+
+// fetchDevicesCached avoids listing the whole enterprise on every poll. A
+// cache hit is served as-is, so trait values can be up to
+// device_cache_ttl_minutes old; the next miss lists the devices again. A
+// cache entry that can't be decoded is dropped and treated as a miss.
+func (m *Monitor) fetchDevicesCached(ctx context.Context, token string) ([]Device, error) {
+	cfg := m.config()
+	cached, err := m.rdb.Get(ctx, deviceCacheKey).Bytes()
+	if err == nil {
+		devices, err := m.decodeCachedDevices(cached)
+		if err == nil && len(devices) > 0 {
+			return devices, nil
+		}
+		if err != nil {
+			m.logger.Warn("device cache is unreadable, refreshing device list", "err", err)
+		}
+		m.invalidateDeviceCache(ctx)
+	}
+
+	devices, err := m.fetchDevices(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	var list []map[string]json.RawMessage
+	for _, d := range devices {
+		list = append(list, d.traitMap())
+	}
+	if data, err := json.Marshal(list); err == nil {
+		m.rdb.Set(ctx, deviceCacheKey, data, time.Duration(cfg.DeviceCacheTTLMinutes)*time.Minute)
+	}
+	return devices, nil
+}
+
+// decodeCachedDevices parses the cached list, skipping devices whose traits
+// no longer parse, as FetchDevices does for the live list.
+func (m *Monitor) decodeCachedDevices(cached []byte) ([]Device, error) {
+	var list []map[string]json.RawMessage
+	if err := json.Unmarshal(cached, &list); err != nil {
+		return nil, err
+	}
+	var devices []Device
+	for _, traits := range list {
+		d, err := UnmarshalDevice(traits)
+		if err != nil {
+			m.logger.Error("skipping malformed cached device", "device", string(traits["deviceName"]), "err", err)
+			continue
+		}
+		devices = append(devices, *d)
+	}
+	return devices, nil
+}
+
+func (m *Monitor) invalidateDeviceCache(ctx context.Context) {
+	m.rdb.Del(ctx, deviceCacheKey)
+}
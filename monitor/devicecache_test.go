@@ -0,0 +1,44 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFetchDevicesCachedServesCacheHit(t *testing.T) {
+	d := testDevice(t, "dev1", 21, "HEAT", 20)
+	tm := newTestMonitor(t, testConfig(t, nil), &MockThermostatClient{Devices: []Device{d}})
+	ctx := context.Background()
+
+	if _, err := tm.fetchDevicesCached(ctx, "token"); err != nil {
+		t.Fatalf("fetchDevicesCached: %v", err)
+	}
+	devices, err := tm.fetchDevicesCached(ctx, "token")
+	if err != nil {
+		t.Fatalf("fetchDevicesCached: %v", err)
+	}
+	if tm.client.Fetches != 1 {
+		t.Errorf("made %d list calls, want 1 for the miss and none for the hit", tm.client.Fetches)
+	}
+	if len(devices) != 1 || devices[0].ID != "dev1" || devices[0].Ambient != 21 {
+		t.Errorf("cache hit returned %+v, want dev1 at 21°C", devices)
+	}
+}
+
+func TestFetchDevicesCachedDropsUnreadableCache(t *testing.T) {
+	d := testDevice(t, "dev1", 21, "HEAT", 20)
+	tm := newTestMonitor(t, testConfig(t, nil), &MockThermostatClient{Devices: []Device{d}})
+	ctx := context.Background()
+	tm.rdb.Set(ctx, deviceCacheKey, "not json", 0)
+
+	devices, err := tm.fetchDevicesCached(ctx, "token")
+	if err != nil {
+		t.Fatalf("fetchDevicesCached: %v", err)
+	}
+	if len(devices) != 1 || tm.client.Fetches != 1 {
+		t.Errorf("got %d devices from %d list calls, want 1 from the API", len(devices), tm.client.Fetches)
+	}
+	if got, _ := tm.redis.Get(deviceCacheKey); got == "not json" {
+		t.Error("unreadable cache entry was kept")
+	}
+}
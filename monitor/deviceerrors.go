@@ -0,0 +1,48 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+)
+
+// DeviceError is a failure to process one device's sample.
+type DeviceError struct {
+	DeviceID string
+	Err      error
+}
+
+func (e DeviceError) Error() string {
+	return fmt.Sprintf("device %s: %v", e.DeviceID, e.Err)
+}
+
+func (e DeviceError) Unwrap() error {
+	return e.Err
+}
+
+// deviceErrorsKey counts a device's consecutive failed polls.
+func deviceErrorsKey(deviceID string) string {
+	return fmt.Sprintf("nest:%s:consecutive_errors", deviceID)
+}
+
+// trackDeviceError counts a failed poll of a device and alerts once when it
+// has failed device_error_alert_threshold polls in a row.
+func (m *Monitor) trackDeviceError(ctx context.Context, de DeviceError) {
+	m.metrics.deviceErrors.WithLabelValues(de.DeviceID).Inc()
+	n, err := m.rdb.Incr(ctx, deviceErrorsKey(de.DeviceID)).Result()
+	if err != nil {
+		m.logger.Warn("failed to count device error", "device_id", de.DeviceID, "err", err)
+		return
+	}
+	threshold := int64(m.config().DeviceErrorAlertThreshold)
+	if n != threshold {
+		return
+	}
+	m.alert(ctx, AlertDeviceError, de.DeviceID, fmt.Sprintf("Processing failed for %d consecutive polls: %v", n, de.Err))
+}
+
+// clearDeviceErrors resets a device's count of consecutive failed polls.
+func (m *Monitor) clearDeviceErrors(ctx context.Context, deviceID string) {
+	if err := m.rdb.Del(ctx, deviceErrorsKey(deviceID)).Err(); err != nil {
+		m.logger.Warn("failed to reset device error count", "device_id", deviceID, "err", err)
+	}
+}
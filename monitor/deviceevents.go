@@ -0,0 +1,130 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// deviceEventsLen is how many state changes are kept per device.
+const deviceEventsLen = 200
+
+// Device event types.
+const (
+	EventHvacState     = "hvac_state"
+	EventConnectivity  = "connectivity"
+	EventSetpoints     = "setpoints"
+	EventSetMode       = "set_mode"
+	EventTurnOff       = "turn_off"
+	EventTurnOn        = "turn_on"
+	EventSetpointGuard = "setpoint_guard"
+	EventDiscovered    = "discovered"
+)
+
+// deviceEventsKey lists a device's state changes, newest first.
+func deviceEventsKey(deviceID string) string {
+	return fmt.Sprintf("nest:%s:events", deviceID)
+}
+
+// DeviceEvent is one entry in a device's event log.
+type DeviceEvent struct {
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`
+	Detail string    `json:"detail"`
+}
+
+// RecordDeviceEvent appends a state change to the device's event log,
+// keeping the last 200.
+func RecordDeviceEvent(ctx context.Context, rdb *redis.Client, deviceID, eventType, detail string) error {
+	data, err := json.Marshal(DeviceEvent{Time: time.Now(), Type: eventType, Detail: detail})
+	if err != nil {
+		return err
+	}
+	key := deviceEventsKey(deviceID)
+	_, err = rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.LPush(ctx, key, data)
+		p.LTrim(ctx, key, 0, deviceEventsLen-1)
+		return nil
+	})
+	return err
+}
+
+// recordEvent records a device event, logging rather than returning a
+// failure so the event log can't interrupt what it is recording.
+func (m *Monitor) recordEvent(ctx context.Context, deviceID, eventType, detail string) {
+	if m.rdb == nil || deviceID == SimulatedDeviceID {
+		return
+	}
+	if err := RecordDeviceEvent(ctx, m.rdb.Client, deviceID, eventType, detail); err != nil {
+		m.logger.Warn("failed to record device event", "device_id", deviceID, "type", eventType, "err", err)
+	}
+}
+
+// recordStateChanges records HVAC state and connectivity changes between
+// the previous sample and this one.
+func (m *Monitor) recordStateChanges(ctx context.Context, deviceID string, prev, cur Sample) {
+	if prev.HvacState != cur.HvacState {
+		m.recordEvent(ctx, deviceID, EventHvacState, fmt.Sprintf("%s -> %s", prev.HvacState, cur.HvacState))
+	}
+	if prev.Connectivity != cur.Connectivity && prev.Connectivity != "" && cur.Connectivity != "" {
+		m.recordEvent(ctx, deviceID, EventConnectivity, fmt.Sprintf("%s -> %s", prev.Connectivity, cur.Connectivity))
+	}
+}
+
+// ListDeviceEvents returns up to limit of the device's most recent events,
+// newest first. A limit of zero or less returns all of them.
+func (m *Monitor) ListDeviceEvents(ctx context.Context, deviceID string, limit int) ([]DeviceEvent, error) {
+	stop := int64(limit) - 1
+	if limit <= 0 {
+		stop = -1
+	}
+	raw, err := m.rdb.LRange(ctx, deviceEventsKey(deviceID), 0, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+	events := make([]DeviceEvent, 0, len(raw))
+	for _, r := range raw {
+		var e DeviceEvent
+		if err := json.Unmarshal([]byte(r), &e); err == nil {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// serveDeviceEvents handles GET /events/{deviceID}, listing the device's
+// event log (?limit=N, default 50).
+func (m *Monitor) serveDeviceEvents(w http.ResponseWriter, r *http.Request) {
+	deviceID := strings.TrimPrefix(r.URL.Path, "/events/")
+	if deviceID == "" || strings.Contains(deviceID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	events, err := m.ListDeviceEvents(r.Context(), deviceID, limit)
+	if err != nil {
+		m.logger.Error("failed to list device events", "device_id", deviceID, "err", err)
+		http.Error(w, "failed to list device events", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
@@ -0,0 +1,100 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DeviceInfo is a device's descriptive metadata.
+type DeviceInfo struct {
+	CustomName string `json:"custom_name,omitempty"`
+	RoomName   string `json:"room_name,omitempty"`
+	// StructureID identifies the home the device is in. Its name isn't
+	// part of the device's traits.
+	StructureID string `json:"structure_id,omitempty"`
+	// DeviceType is the device's type, e.g. sdm.devices.types.THERMOSTAT.
+	DeviceType string `json:"device_type,omitempty"`
+}
+
+// ParseDeviceInfo reads DeviceInfo from a device's traits, keyed as for
+// UnmarshalDevice, plus the device type under "deviceType". Missing or
+// malformed traits leave their fields empty.
+func ParseDeviceInfo(traits map[string]json.RawMessage) DeviceInfo {
+	var (
+		info      DeviceInfo
+		infoTrait struct {
+			CustomName string `json:"customName"`
+		}
+		parents struct {
+			ParentRelations []struct {
+				Parent      string `json:"parent"`
+				DisplayName string `json:"displayName"`
+			} `json:"parentRelations"`
+		}
+	)
+	if json.Unmarshal(traits["sdm.devices.traits.Info"], &infoTrait) == nil {
+		info.CustomName = infoTrait.CustomName
+	}
+	if json.Unmarshal(traits["sdm.devices.traits.ParentRelations"], &parents) == nil && len(parents.ParentRelations) > 0 {
+		p := parents.ParentRelations[0]
+		info.RoomName = p.DisplayName
+		// Parent is enterprises/{project}/structures/{structure}/rooms/{room}.
+		parts := strings.Split(p.Parent, "/")
+		for i := 0; i+1 < len(parts); i++ {
+			if parts[i] == "structures" {
+				info.StructureID = parts[i+1]
+			}
+		}
+	}
+	json.Unmarshal(traits["deviceType"], &info.DeviceType)
+	return info
+}
+
+// deviceInfoKey is a hash of the device's DeviceInfo fields, for lookups
+// that don't have the device's traits to hand.
+func deviceInfoKey(deviceID string) string {
+	return fmt.Sprintf("nest:%s:info", deviceID)
+}
+
+// recordDeviceInfo stores the device's metadata in its info hash.
+func (m *Monitor) recordDeviceInfo(ctx context.Context, d *Device) error {
+	info := ParseDeviceInfo(d.traitMap())
+	return m.rdb.HSet(ctx, deviceInfoKey(d.ID),
+		"custom_name", info.CustomName,
+		"room", info.RoomName,
+		"structure_id", info.StructureID,
+		"type", info.DeviceType,
+	).Err()
+}
+
+// checkNewDevice logs a device seen for the first time, i.e. one with no
+// stored samples, and with alert_on_new_device set sends a low-priority
+// new_device alert describing it.
+func (m *Monitor) checkNewDevice(ctx context.Context, d *Device) error {
+	n, err := m.rdb.Exists(ctx, samplesKey(d.ID)).Result()
+	if err != nil || n > 0 {
+		return err
+	}
+	info := ParseDeviceInfo(d.traitMap())
+	name := m.displayName(d.ID)
+	m.logger.Info("new device discovered", "device_id", d.ID, "name", name, "type", info.DeviceType, "room", info.RoomName)
+	m.recordEvent(ctx, d.ID, EventDiscovered, fmt.Sprintf("first seen: %s (%s) in %s", name, info.DeviceType, info.RoomName))
+	if !m.config().AlertOnNewDevice {
+		return nil
+	}
+	return m.alert(ctx, AlertNewDevice, d.ID, fmt.Sprintf("New device discovered: %s, model %s, room %s", name, info.DeviceType, info.RoomName))
+}
+
+// displayName is how alerts refer to a device: its custom name from the
+// last known traits, else its alias, else its ID.
+func (m *Monitor) displayName(deviceID string) string {
+	if d := m.traits.device(m.deviceName(deviceID)); d != nil && d.CustomName != "" {
+		return d.CustomName
+	}
+	if alias := m.config().DeviceAliases[deviceID]; alias != "" {
+		return alias
+	}
+	return deviceID
+}
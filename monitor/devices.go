@@ -0,0 +1,110 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// DeviceSummary is a snapshot of a device's identity and current state, as
+// printed by the list-devices subcommand.
+type DeviceSummary struct {
+	DeviceID     string  `json:"device_id"`
+	Alias        string  `json:"alias,omitempty"`
+	Model        string  `json:"model,omitempty"`
+	Mode         string  `json:"mode,omitempty"`
+	HvacState    string  `json:"hvac_state,omitempty"`
+	Ambient      float64 `json:"ambient"`
+	Unit         string  `json:"unit,omitempty"`
+	Connectivity string  `json:"connectivity,omitempty"`
+}
+
+// ListDevices fetches every device visible to the project straight from the
+// SDM API, bypassing the device cache.
+func (m *Monitor) ListDevices(ctx context.Context) ([]DeviceSummary, error) {
+	token, err := m.tokens.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := m.fetchDevices(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	var summaries []DeviceSummary
+	for i := range devices {
+		m.applyForcedUnit(&devices[i])
+		summaries = append(summaries, summarizeDevice(&devices[i], m.config()))
+	}
+	return summaries, nil
+}
+
+// DeviceTraits fetches the raw traits of the device named by its full name
+// or short ID straight from the SDM API, as they were received.
+func (m *Monitor) DeviceTraits(ctx context.Context, device string) (map[string]json.RawMessage, error) {
+	token, err := m.tokens.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := m.fetchDevices(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	for i := range devices {
+		if matchesDevice(&devices[i], device) {
+			return devices[i].Traits, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", device, errDeviceNotFound)
+}
+
+func summarizeDevice(d *Device, cfg *Config) DeviceSummary {
+	return DeviceSummary{
+		DeviceID:     d.ID,
+		Alias:        cfg.DeviceAliases[d.ID],
+		Model:        d.CustomName,
+		Mode:         d.Mode,
+		HvacState:    d.HvacState,
+		Ambient:      d.Ambient,
+		Unit:         d.Unit,
+		Connectivity: d.Connectivity,
+	}
+}
+
+// resetBatchSize is how many keys ResetDevice deletes per DEL.
+const resetBatchSize = 100
+
+// ResetDevice deletes every Redis key belonging to deviceID (nest:<id>:*)
+// and returns the deleted keys.
+func (m *Monitor) ResetDevice(ctx context.Context, deviceID string) ([]string, error) {
+	var deleted, batch []string
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := m.rdb.Del(ctx, batch...).Err(); err != nil {
+			return err
+		}
+		deleted = append(deleted, batch...)
+		batch = batch[:0]
+		return nil
+	}
+
+	iter := m.rdb.Scan(ctx, 0, fmt.Sprintf("nest:%s:*", deviceID), resetBatchSize).Iterator()
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == resetBatchSize {
+			if err := flush(); err != nil {
+				return deleted, err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return deleted, err
+	}
+	if err := flush(); err != nil {
+		return deleted, err
+	}
+	m.logger.Info("device reset", "device_id", deviceID, "deleted", len(deleted), "keys", deleted)
+	return deleted, nil
+}
@@ -0,0 +1,61 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func shortenEmptyDeviceListWait(t *testing.T) {
+	t.Helper()
+	old := emptyDeviceListWait
+	emptyDeviceListWait = time.Millisecond
+	t.Cleanup(func() { emptyDeviceListWait = old })
+}
+
+func TestGetDevicesRetriesEmptyList(t *testing.T) {
+	shortenEmptyDeviceListWait(t)
+	d := testDevice(t, "dev1", 21, "OFF", 20)
+	client := &MockThermostatClient{Devices: []Device{d}}
+	calls := 0
+	client.FetchDevicesFunc = func(ctx context.Context, token string) ([]Device, error) {
+		calls++
+		if calls == 1 {
+			return nil, nil
+		}
+		return []Device{d}, nil
+	}
+	tm := newTestMonitor(t, testConfig(t, nil), client)
+
+	devices, err := tm.getDevices(context.Background(), "token")
+	if err != nil {
+		t.Fatalf("getDevices: %v", err)
+	}
+	if len(devices) != 1 || devices[0].ID != "dev1" {
+		t.Errorf("getDevices = %+v, want dev1", devices)
+	}
+	if calls != 2 {
+		t.Errorf("listed devices %d times, want 2", calls)
+	}
+	if alerts := tm.notifier.ofType(AlertNoDevices); len(alerts) != 0 {
+		t.Errorf("sent %d %s alerts after a transient empty list, want none", len(alerts), AlertNoDevices)
+	}
+}
+
+func TestGetDevicesAlertsWhenAlwaysEmpty(t *testing.T) {
+	shortenEmptyDeviceListWait(t)
+	client := &MockThermostatClient{}
+	tm := newTestMonitor(t, testConfig(t, map[string]any{"empty_device_list_retries": 2}), client)
+
+	_, err := tm.getDevices(context.Background(), "token")
+	if !errors.Is(err, ErrNoDevices) {
+		t.Fatalf("getDevices error = %v, want ErrNoDevices", err)
+	}
+	if client.Fetches != 3 {
+		t.Errorf("listed devices %d times, want 3 (1 + 2 retries)", client.Fetches)
+	}
+	if alerts := tm.notifier.ofType(AlertNoDevices); len(alerts) != 1 {
+		t.Errorf("sent %d %s alerts, want 1", len(alerts), AlertNoDevices)
+	}
+}
@@ -0,0 +1,124 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	discordColorEmergency = 0xE74C3C // red
+	discordColorWarning   = 0xE67E22 // orange
+	discordColorInfo      = 0x3498DB // blue
+
+	discordMaxAttempts = 3
+)
+
+// DiscordNotifier posts alerts as embeds to a Discord webhook.
+type DiscordNotifier struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+type discordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbed struct {
+	Title       string              `json:"title"`
+	Description string              `json:"description"`
+	Color       int                 `json:"color"`
+	Timestamp   string              `json:"timestamp"`
+	Fields      []discordEmbedField `json:"fields"`
+}
+
+func (d *DiscordNotifier) Name() string {
+	return "discord"
+}
+
+func discordColor(priority string) int {
+	p, _ := strconv.Atoi(priority)
+	switch {
+	case p >= 2:
+		return discordColorEmergency
+	case p == 1:
+		return discordColorWarning
+	default:
+		return discordColorInfo
+	}
+}
+
+func (d *DiscordNotifier) Notify(ctx context.Context, event AlertEvent) error {
+	ts := event.Time.UTC().Format(time.RFC3339)
+	fields := []discordEmbedField{
+		{Name: "Device", Value: event.device(), Inline: true},
+		{Name: "Alert type", Value: event.Type, Inline: true},
+		{Name: "Time", Value: ts, Inline: true},
+	}
+	if event.Ambient != nil {
+		fields = append(fields, discordEmbedField{Name: "Ambient", Value: fmt.Sprintf("%.1f", *event.Ambient), Inline: true})
+	}
+	body, err := json.Marshal(map[string]any{
+		"embeds": []discordEmbed{{
+			Title:       event.title(),
+			Description: event.Message,
+			Color:       discordColor(event.Priority),
+			Timestamp:   ts,
+			Fields:      fields,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "POST", d.WebhookURL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := d.Client.Do(req)
+		if err != nil {
+			// The error includes the URL, and so the webhook token.
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				urlErr.URL = redactURL(req.URL)
+			}
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < discordMaxAttempts {
+			wait := retryAfter(resp.Header.Get("Retry-After"))
+			select {
+			case <-time.After(wait):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("discord returned status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// retryAfter parses a Retry-After header given in (possibly fractional)
+// seconds, defaulting to one second.
+func retryAfter(header string) time.Duration {
+	secs, err := strconv.ParseFloat(header, 64)
+	if err != nil || secs <= 0 {
+		return time.Second
+	}
+	return time.Duration(secs * float64(time.Second))
+}
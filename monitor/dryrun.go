@@ -0,0 +1,83 @@
+package monitor
+
+import (
+	"context"
+	"log/slog"
+	"net"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisWrites are the commands the monitor writes to Redis with. A dry run
+// drops them and lets every other command through.
+var redisWrites = map[string]bool{
+	"set": true, "setnx": true, "incr": true, "del": true, "expire": true, "pexpire": true, "rename": true,
+	"lpush": true, "rpush": true, "ltrim": true, "hset": true, "hincrby": true, "hincrbyfloat": true,
+	"zadd": true, "zrem": true, "zremrangebyscore": true, "publish": true,
+}
+
+// dryRunHook drops Redis writes, logging each one. Dropped SETNX commands
+// report success, so checks behave as they would on a fresh episode and log
+// the alert they would send.
+type dryRunHook struct {
+	logger *slog.Logger
+}
+
+func (h dryRunHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h dryRunHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if h.drop(cmd) {
+			return nil
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h dryRunHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		var kept []redis.Cmder
+		for _, cmd := range cmds {
+			if !h.drop(cmd) {
+				kept = append(kept, cmd)
+			}
+		}
+		if len(kept) == 0 {
+			return nil
+		}
+		return next(ctx, kept)
+	}
+}
+
+func (h dryRunHook) drop(cmd redis.Cmder) bool {
+	if !redisWrites[cmd.Name()] {
+		return false
+	}
+	if c, ok := cmd.(*redis.BoolCmd); ok && cmd.Name() == "setnx" {
+		c.SetVal(true)
+	}
+	h.logger.Debug("dry run: skipping redis write", "cmd", cmd.String())
+	return true
+}
+
+// dryRunClient fetches devices as usual but only logs the commands it would
+// send.
+type dryRunClient struct {
+	ThermostatClient
+	logger *slog.Logger
+}
+
+func (c dryRunClient) ExecuteCommand(ctx context.Context, token, deviceName, command string, params map[string]any) error {
+	c.logger.Info("dry run: skipping command", "device", deviceName, "command", command, "params", params)
+	return nil
+}
+
+// matchesDevice reports whether d is the device named by filter, given
+// either as its full resource name or its short ID.
+func matchesDevice(d *Device, filter string) bool {
+	return filter == "" || d.Name == filter || d.ID == filter
+}
@@ -0,0 +1,42 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmailNotifier sends alerts by SMTP. Auth is skipped when Username is empty.
+type EmailNotifier struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+func (e *EmailNotifier) Name() string {
+	return "email"
+}
+
+func (e *EmailNotifier) Notify(ctx context.Context, event AlertEvent) error {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s: %s\r\n", event.title(), event.device())
+	fmt.Fprintf(&msg, "Date: %s\r\n", event.Time.Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s: %s\r\n\r\nDevice ID: %s\r\nAlert type: %s\r\nPriority: %s\r\n", event.device(), event.Message, event.DeviceID, event.Type, event.Priority)
+
+	var auth smtp.Auth
+	if e.Username != "" {
+		auth = smtp.PlainAuth("", e.Username, e.Password, e.Host)
+	}
+	addr := net.JoinHostPort(e.Host, strconv.Itoa(e.Port))
+	return smtp.SendMail(addr, auth, e.From, e.To, []byte(msg.String()))
+}
@@ -0,0 +1,128 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// emergencyDeviceIDs returns every device's ID from the cached device list,
+// falling back to listing devices from the SDM API on a cache miss.
+func (m *Monitor) emergencyDeviceIDs(ctx context.Context, token string) ([]string, error) {
+	var ids []string
+	if cached, err := m.rdb.Get(ctx, deviceCacheKey).Bytes(); err == nil {
+		var list []map[string]json.RawMessage
+		if json.Unmarshal(cached, &list) == nil {
+			for _, traits := range list {
+				var name string
+				if json.Unmarshal(traits["deviceName"], &name) == nil && name != "" {
+					ids = append(ids, deviceIDFromName(name))
+				}
+			}
+		}
+	}
+	if len(ids) > 0 {
+		return ids, nil
+	}
+	devices, err := m.fetchDevices(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range devices {
+		ids = append(ids, d.ID)
+	}
+	return ids, nil
+}
+
+// turnOffAllThermostats turns every device off concurrently, saving each
+// one's state as turnOffThermostat does, and sends one emergency_shutoff
+// alert listing which devices were and weren't turned off.
+func (m *Monitor) turnOffAllThermostats(ctx context.Context, token string) ([]DeviceError, error) {
+	ids, err := m.emergencyDeviceIDs(ctx, token)
+	if err != nil {
+		m.logger.Error("emergency shutoff: failed to list devices", "err", err)
+		m.alert(ctx, AlertEmergencyShutoff, "N/A", "Emergency shutoff failed to list devices: "+err.Error())
+		return nil, err
+	}
+
+	var (
+		g      errgroup.Group
+		mu     sync.Mutex
+		off    []string
+		failed []DeviceError
+	)
+	g.SetLimit(m.config().MaxConcurrentDevices)
+	for _, id := range ids {
+		id := id
+		g.Go(func() error {
+			err := m.shutOff(ctx, id, token)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				m.logger.Error("emergency shutoff failed", "device_id", id, "err", err)
+				failed = append(failed, DeviceError{DeviceID: id, Err: err})
+				return nil
+			}
+			m.recordEvent(ctx, id, EventTurnOff, "turned off by emergency shutoff")
+			off = append(off, m.displayName(id))
+			return nil
+		})
+	}
+	g.Wait()
+
+	sort.Strings(off)
+	sort.Slice(failed, func(i, j int) bool { return failed[i].DeviceID < failed[j].DeviceID })
+	msg := fmt.Sprintf("Emergency shutoff: %d of %d thermostats turned off", len(off), len(ids))
+	if len(off) > 0 {
+		msg += ". Off: " + strings.Join(off, ", ")
+	}
+	if len(failed) > 0 {
+		names := make([]string, len(failed))
+		for i, de := range failed {
+			names[i] = fmt.Sprintf("%s (%v)", m.displayName(de.DeviceID), de.Err)
+		}
+		msg += ". Failed: " + strings.Join(names, ", ")
+	}
+	m.logger.Warn("emergency shutoff", "turned_off", len(off), "failed", len(failed))
+	m.alert(ctx, AlertEmergencyShutoff, "N/A", msg)
+	return failed, nil
+}
+
+// serveEmergencyShutoff handles POST /emergency-shutoff, which turns every
+// thermostat off. It needs an X-Admin-Token header matching admin_token.
+// The response lists the devices that couldn't be turned off.
+func (m *Monitor) serveEmergencyShutoff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !m.adminAuthorized(r) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	token, err := m.tokens.Get(r.Context())
+	if err != nil {
+		http.Error(w, "no access token", http.StatusServiceUnavailable)
+		return
+	}
+	failed, err := m.turnOffAllThermostats(WithOperator(r.Context(), "http "+r.RemoteAddr), token)
+	if err != nil {
+		http.Error(w, "failed to list devices", http.StatusBadGateway)
+		return
+	}
+	errs := map[string]string{}
+	for _, de := range failed {
+		errs[de.DeviceID] = de.Err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if len(failed) > 0 {
+		w.WriteHeader(http.StatusMultiStatus)
+	}
+	json.NewEncoder(w).Encode(map[string]any{"failed": errs})
+}
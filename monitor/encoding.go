@@ -0,0 +1,97 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Sample encodings for Redis, selected by Config.RedisSampleEncoding.
+const (
+	encodingJSON    = "json"
+	encodingMsgpack = "msgpack"
+)
+
+// encodeSample serializes s for storage. Msgpack reuses the JSON field names
+// so both encodings hold the same data.
+func encodeSample(encoding string, s Sample) ([]byte, error) {
+	if encoding != encodingMsgpack {
+		return json.Marshal(s)
+	}
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(s); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeSample parses a stored sample in either encoding, so lists written
+// before a change of encoding keep working.
+func decodeSample(raw string) (Sample, error) {
+	var s Sample
+	if strings.HasPrefix(raw, "{") {
+		err := json.Unmarshal([]byte(raw), &s)
+		return s, err
+	}
+	dec := msgpack.NewDecoder(strings.NewReader(raw))
+	dec.SetCustomStructTag("json")
+	err := dec.Decode(&s)
+	return s, err
+}
+
+// decodeSamples parses stored samples, skipping any that are malformed.
+func decodeSamples(raw []string) []Sample {
+	samples := make([]Sample, 0, len(raw))
+	for _, r := range raw {
+		if s, err := decodeSample(r); err == nil {
+			samples = append(samples, s)
+		}
+	}
+	return samples
+}
+
+// MigrateSampleEncoding rewrites every device's stored samples in the
+// configured encoding and returns how many lists were rewritten. Malformed
+// entries are dropped.
+func (m *Monitor) MigrateSampleEncoding(ctx context.Context) (int, error) {
+	encoding := m.config().RedisSampleEncoding
+	migrated := 0
+	iter := m.rdb.Scan(ctx, 0, samplesKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		raw, err := m.rdb.LRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return migrated, fmt.Errorf("%s: %w", key, err)
+		}
+		samples := decodeSamples(raw)
+		entries := make([]any, 0, len(samples))
+		for _, s := range samples {
+			data, err := encodeSample(encoding, s)
+			if err != nil {
+				return migrated, fmt.Errorf("%s: %w", key, err)
+			}
+			entries = append(entries, data)
+		}
+
+		_, err = m.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.Del(ctx, key)
+			if len(entries) > 0 {
+				p.RPush(ctx, key, entries...)
+			}
+			return nil
+		})
+		if err != nil {
+			return migrated, fmt.Errorf("%s: %w", key, err)
+		}
+		m.logger.Info("migrated samples", "key", key, "encoding", encoding, "samples", len(entries), "dropped", len(raw)-len(entries))
+		migrated++
+	}
+	return migrated, iter.Err()
+}
@@ -0,0 +1,73 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func benchSample() Sample {
+	occupied := true
+	return Sample{
+		Ambient:      20.72,
+		HvacState:    "HEATING",
+		Heat:         21.5,
+		Ts:           time.Date(2024, 1, 15, 7, 30, 0, 0, time.UTC),
+		Connectivity: "ONLINE",
+		Occupied:     &occupied,
+		FanTimerMode: "OFF",
+	}
+}
+
+func TestSampleEncodingRoundTrip(t *testing.T) {
+	for _, encoding := range []string{encodingJSON, encodingMsgpack} {
+		data, err := encodeSample(encoding, benchSample())
+		if err != nil {
+			t.Fatalf("%s: encodeSample: %v", encoding, err)
+		}
+		got, err := decodeSample(string(data))
+		if err != nil {
+			t.Fatalf("%s: decodeSample: %v", encoding, err)
+		}
+		want := benchSample()
+		if !got.Ts.Equal(want.Ts) {
+			t.Errorf("%s: decoded ts %v, want %v", encoding, got.Ts, want.Ts)
+		}
+		// Msgpack decodes times in the local zone.
+		got.Ts = want.Ts
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: decoded %+v, want %+v", encoding, got, want)
+		}
+	}
+}
+
+// BenchmarkSampleEncoding encodes and decodes a sample in each encoding,
+// reporting the encoded size, which is what each list entry costs in Redis.
+func BenchmarkSampleEncoding(b *testing.B) {
+	sample := benchSample()
+	for _, encoding := range []string{encodingJSON, encodingMsgpack} {
+		data, err := encodeSample(encoding, sample)
+		if err != nil {
+			b.Fatal(err)
+		}
+		raw := string(data)
+
+		b.Run(encoding+"/encode", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := encodeSample(encoding, sample); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(data)), "bytes/sample")
+		})
+		b.Run(encoding+"/decode", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := decodeSample(raw); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	escalateAlways           = "always"
+	escalateIfUnacknowledged = "if-unacknowledged"
+)
+
+// escalationInterval is how often RunEscalations looks for due steps.
+const escalationInterval = 30 * time.Second
+
+// EscalationStep re-sends an emergency alert through one notifier,
+// DelayMinutes after it was first sent. With the if-unacknowledged condition
+// the step is dropped once the alert has been acknowledged.
+type EscalationStep struct {
+	NotifierName string `json:"notifier"`
+	DelayMinutes int    `json:"delay_minutes"`
+	Condition    string `json:"condition"`
+}
+
+// escalationKey is a sorted set of the device's pending escalation steps,
+// scored by the Unix time each is due.
+func escalationKey(deviceID string) string {
+	return fmt.Sprintf("nest:%s:escalation", deviceID)
+}
+
+// escalationAckKey is set when the device's latest emergency alert has been
+// acknowledged.
+func escalationAckKey(deviceID string) string {
+	return fmt.Sprintf("nest:%s:escalation_ack", deviceID)
+}
+
+type pendingEscalation struct {
+	Step  int        `json:"step"`
+	Event AlertEvent `json:"event"`
+}
+
+// scheduleEscalation queues every step of escalation_chain for an emergency
+// priority alert. Simulated alerts and alerts not about a device aren't
+// escalated.
+func (m *Monitor) scheduleEscalation(ctx context.Context, event AlertEvent) error {
+	chain := m.config().EscalationChain
+	if len(chain) == 0 || m.rdb == nil || event.Priority != "2" || event.DeviceID == "N/A" || event.Simulated {
+		return nil
+	}
+	key := escalationKey(event.DeviceID)
+	_, err := m.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.Del(ctx, escalationAckKey(event.DeviceID))
+		for i, step := range chain {
+			data, err := json.Marshal(pendingEscalation{Step: i, Event: event})
+			if err != nil {
+				return err
+			}
+			due := event.Time.Add(time.Duration(step.DelayMinutes) * time.Minute)
+			p.ZAdd(ctx, key, redis.Z{Score: float64(due.Unix()), Member: data})
+		}
+		return nil
+	})
+	return err
+}
+
+// AcknowledgeAlert stops the device's pending if-unacknowledged escalation
+// steps from being sent.
+func (m *Monitor) AcknowledgeAlert(ctx context.Context, deviceID string) error {
+	if err := m.rdb.Set(ctx, escalationAckKey(deviceID), time.Now().Unix(), 0).Err(); err != nil {
+		return err
+	}
+	m.logger.Info("alert acknowledged", "device_id", deviceID)
+	return nil
+}
+
+// RunEscalations sends due escalation steps every escalationInterval until
+// ctx is cancelled.
+func (m *Monitor) RunEscalations(ctx context.Context) {
+	for {
+		if err := m.processEscalations(ctx); err != nil {
+			m.logger.Error("failed to process escalations", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(escalationInterval):
+		}
+	}
+}
+
+// processEscalations sends every escalation step that is due.
+func (m *Monitor) processEscalations(ctx context.Context) error {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	iter := m.rdb.Scan(ctx, 0, escalationKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		due, err := m.rdb.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: "-inf", Max: now}).Result()
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		for _, member := range due {
+			// Removing the step claims it, so two processes never both send it.
+			n, err := m.rdb.ZRem(ctx, key, member).Result()
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			if n == 1 {
+				m.escalate(ctx, member)
+			}
+		}
+	}
+	return iter.Err()
+}
+
+func (m *Monitor) escalate(ctx context.Context, member string) {
+	var p pendingEscalation
+	if err := json.Unmarshal([]byte(member), &p); err != nil {
+		m.logger.Warn("dropping malformed escalation step", "err", err)
+		return
+	}
+	chain := m.config().EscalationChain
+	if p.Step >= len(chain) {
+		// The chain was shortened since the alert was sent.
+		return
+	}
+	step := chain[p.Step]
+	deviceID := p.Event.DeviceID
+	if step.Condition == escalateIfUnacknowledged {
+		acked, err := m.rdb.Exists(ctx, escalationAckKey(deviceID)).Result()
+		if err != nil {
+			m.logger.Error("failed to check acknowledgement", "device_id", deviceID, "err", err)
+			return
+		}
+		if acked > 0 {
+			m.logger.Info("alert acknowledged, skipping escalation", "device_id", deviceID, "notifier", step.NotifierName)
+			return
+		}
+	}
+
+	n := m.notifierNamed(step.NotifierName)
+	if n == nil {
+		m.logger.Error("escalation notifier not configured", "notifier", step.NotifierName)
+		return
+	}
+	if err := n.Notify(ctx, p.Event); err != nil {
+		m.logger.Error("failed to send escalation", "notifier", n.Name(), "type", p.Event.Type, "device_id", deviceID, "err", err)
+		return
+	}
+	m.logger.Info("alert escalated", "notifier", n.Name(), "type", p.Event.Type, "device_id", deviceID, "step", p.Step+1)
+}
+
+func validateEscalationChain(c *Config) error {
+	for i, step := range c.EscalationChain {
+		if step.Condition != escalateAlways && step.Condition != escalateIfUnacknowledged {
+			return fmt.Errorf("escalation_chain[%d]: condition must be %s or %s, got %q", i, escalateAlways, escalateIfUnacknowledged, step.Condition)
+		}
+		if step.DelayMinutes < 0 {
+			return fmt.Errorf("escalation_chain[%d]: delay_minutes can't be negative", i)
+		}
+		configured := false
+		for _, n := range append(configuredNotifiers(c, nil, nil), escalationNotifiers(c, nil)...) {
+			configured = configured || n.Name() == step.NotifierName
+		}
+		// The Redis notifier isn't built without a client, so check its flag.
+		if step.NotifierName == "redis" && c.PublishAlertsToRedis {
+			configured = true
+		}
+		if !configured {
+			return fmt.Errorf("escalation_chain[%d]: notifier %q is not configured", i, step.NotifierName)
+		}
+	}
+	return nil
+}
+
+// notifierNamed returns the configured notifier with the given name,
+// including those only used for escalation.
+func (m *Monitor) notifierNamed(name string) Notifier {
+	for _, n := range append(m.notifiers, escalationNotifiers(m.config(), m.httpClient)...) {
+		if n.Name() == name {
+			return n
+		}
+	}
+	return nil
+}
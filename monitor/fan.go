@@ -0,0 +1,85 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// fanRuntimeTTL keeps each day's fan runtime for the weekly report.
+const fanRuntimeTTL = reportPeriod + 48*time.Hour
+
+// fanRuntimeKey counts the seconds a device's fan ran on a given day.
+func fanRuntimeKey(deviceID string, day time.Time) string {
+	return fmt.Sprintf("nest:%s:fan_runtime:%s", deviceID, day.Format("2006-01-02"))
+}
+
+// fanRuntimeAlertedKey marks a day whose fan runtime has been alerted on.
+func fanRuntimeAlertedKey(deviceID string, day time.Time) string {
+	return fmt.Sprintf("nest:%s:fan_runtime_alerted:%s", deviceID, day.Format("2006-01-02"))
+}
+
+// fanRunning reports whether the sample's fan timer is on. The fan can run
+// on its own, for circulation, so this is separate from the HVAC state.
+func fanRunning(sample Sample) bool {
+	return sample.FanTimerMode != "" && sample.FanTimerMode != "OFF"
+}
+
+// recordFanRuntime queues adding one poll interval to the day's fan runtime
+// on p, if the fan is running.
+func recordFanRuntime(ctx context.Context, p redis.Pipeliner, deviceID string, sample Sample, interval time.Duration) {
+	if !fanRunning(sample) {
+		return
+	}
+	key := fanRuntimeKey(deviceID, sample.Ts)
+	p.IncrBy(ctx, key, int64(interval.Seconds()))
+	p.Expire(ctx, key, fanRuntimeTTL)
+}
+
+// checkFanRuntime exports the device's fan runtime today and alerts, once a
+// day, when it passes daily_fan_runtime_alert_hours.
+func (m *Monitor) checkFanRuntime(ctx context.Context, deviceID string, sample Sample) error {
+	seconds, err := m.rdb.Get(ctx, fanRuntimeKey(deviceID, sample.Ts)).Int64()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	m.metrics.fanRuntime.WithLabelValues(deviceID).Set(float64(seconds))
+
+	limit := m.config().DailyFanRuntimeAlertHours
+	runtime := time.Duration(seconds) * time.Second
+	if limit <= 0 || runtime.Hours() <= limit {
+		return nil
+	}
+	first, err := m.rdb.SetNX(ctx, fanRuntimeAlertedKey(deviceID, sample.Ts), 1, 48*time.Hour).Result()
+	if err != nil || !first {
+		return err
+	}
+	m.logger.Warn("fan runtime over daily limit", "device_id", deviceID, "runtime", runtime, "limit_hours", limit)
+	return m.alert(ctx, AlertFanRuntime, deviceID, fmt.Sprintf("Fan has run for %s today, over the %gh limit", runtime.Round(time.Minute), limit))
+}
+
+// fanRuntimeSince adds up the device's daily fan runtime from since's day
+// through now's.
+func (m *Monitor) fanRuntimeSince(ctx context.Context, deviceID string, since, now time.Time) (time.Duration, error) {
+	last := fanRuntimeKey(deviceID, now)
+	keys := []string{fanRuntimeKey(deviceID, since)}
+	for day := since; keys[len(keys)-1] != last; {
+		day = day.AddDate(0, 0, 1)
+		keys = append(keys, fanRuntimeKey(deviceID, day))
+	}
+	vals, err := m.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return 0, err
+	}
+	var total time.Duration
+	for _, v := range vals {
+		if s, ok := v.(string); ok {
+			seconds, _ := strconv.ParseInt(s, 10, 64)
+			total += time.Duration(seconds) * time.Second
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,163 @@
+package monitor
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DeviceGroup applies shared thresholds and notifiers to several devices.
+type DeviceGroup struct {
+	Name       string           `json:"name"`
+	DeviceIDs  []string         `json:"device_ids"`
+	Thresholds DeviceThresholds `json:"thresholds"`
+	// Notifiers, if any, replace the global notifiers for the group's
+	// devices.
+	Notifiers []NotifierConfig `json:"notifiers"`
+}
+
+// DeviceThresholds overrides alert thresholds for a group or a single
+// device. Unset fields keep the value from the level above: global config,
+// then group, then device.
+type DeviceThresholds struct {
+	SetpointBounds               *SetpointBounds `json:"setpoint_bounds,omitempty"`
+	HistoricalDeviationThreshold *float64        `json:"historical_deviation_threshold,omitempty"`
+	SetpointDeviationThreshold   *float64        `json:"setpoint_deviation_threshold,omitempty"`
+	DeviceSilenceAlertMinutes    *int            `json:"device_silence_alert_minutes,omitempty"`
+}
+
+// NotifierConfig configures one notifier for a group. Type is pushover,
+// discord or redis; only the fields for that type are used.
+type NotifierConfig struct {
+	Type              string `json:"type"`
+	PushoverUser      string `json:"pushover_user,omitempty"`
+	PushoverToken     string `json:"pushover_token,omitempty"`
+	DiscordWebhookURL string `json:"discord_webhook_url,omitempty"`
+	RedisChannel      string `json:"redis_channel,omitempty"`
+}
+
+func (t DeviceThresholds) apply(c *Config) {
+	if t.SetpointBounds != nil {
+		c.SetpointBounds = t.SetpointBounds
+	}
+	if t.HistoricalDeviationThreshold != nil {
+		c.HistoricalDeviationThreshold = *t.HistoricalDeviationThreshold
+	}
+	if t.SetpointDeviationThreshold != nil {
+		c.SetpointDeviationThreshold = *t.SetpointDeviationThreshold
+	}
+	if t.DeviceSilenceAlertMinutes != nil {
+		c.DeviceSilenceAlertMinutes = *t.DeviceSilenceAlertMinutes
+	}
+}
+
+func (t DeviceThresholds) validate() error {
+	if b := t.SetpointBounds; b != nil && b.Min >= b.Max {
+		return fmt.Errorf("setpoint_bounds: min (%.1f) must be below max (%.1f)", b.Min, b.Max)
+	}
+	if t.DeviceSilenceAlertMinutes != nil && *t.DeviceSilenceAlertMinutes <= 0 {
+		return fmt.Errorf("device_silence_alert_minutes must be positive")
+	}
+	return nil
+}
+
+// groupOf returns the group deviceID belongs to, or nil.
+func (c *Config) groupOf(deviceID string) *DeviceGroup {
+	for i := range c.DeviceGroups {
+		for _, id := range c.DeviceGroups[i].DeviceIDs {
+			if id == deviceID {
+				return &c.DeviceGroups[i]
+			}
+		}
+	}
+	return nil
+}
+
+// forDevice returns a copy of c with deviceID's group thresholds and then
+// its own device_thresholds applied.
+func (c *Config) forDevice(deviceID string) *Config {
+	cp := *c
+	if g := c.groupOf(deviceID); g != nil {
+		g.Thresholds.apply(&cp)
+	}
+	if t, ok := c.DeviceThresholds[deviceID]; ok {
+		t.apply(&cp)
+	}
+	return &cp
+}
+
+func validateDeviceGroups(groups []DeviceGroup, thresholds map[string]DeviceThresholds) error {
+	names := map[string]bool{}
+	member := map[string]string{}
+	for _, g := range groups {
+		if g.Name == "" {
+			return fmt.Errorf("device_groups: every group needs a name")
+		}
+		if names[g.Name] {
+			return fmt.Errorf("device_groups: duplicate group %q", g.Name)
+		}
+		names[g.Name] = true
+		for _, id := range g.DeviceIDs {
+			if other, ok := member[id]; ok {
+				return fmt.Errorf("device_groups: device %s is in both %q and %q", id, other, g.Name)
+			}
+			member[id] = g.Name
+		}
+		if err := g.Thresholds.validate(); err != nil {
+			return fmt.Errorf("device_groups[%s]: %w", g.Name, err)
+		}
+		for _, n := range g.Notifiers {
+			if err := n.validate(); err != nil {
+				return fmt.Errorf("device_groups[%s]: %w", g.Name, err)
+			}
+		}
+	}
+	for id, t := range thresholds {
+		if err := t.validate(); err != nil {
+			return fmt.Errorf("device_thresholds[%s]: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func (n NotifierConfig) validate() error {
+	switch n.Type {
+	case "pushover":
+		if n.PushoverUser == "" || n.PushoverToken == "" {
+			return fmt.Errorf("pushover notifier needs pushover_user and pushover_token")
+		}
+	case "discord":
+		if n.DiscordWebhookURL == "" {
+			return fmt.Errorf("discord notifier needs discord_webhook_url")
+		}
+	case "redis":
+	default:
+		return fmt.Errorf("unknown notifier type %q", n.Type)
+	}
+	return nil
+}
+
+// groupNotifiers builds the notifiers configured for a group. Redis
+// notifiers default to redis_pubsub_channel.
+func groupNotifiers(g *DeviceGroup, cfg *Config, client *http.Client, rdb *redis.Client) []Notifier {
+	var notifiers []Notifier
+	for _, n := range g.Notifiers {
+		switch n.Type {
+		case "pushover":
+			notifiers = append(notifiers, &PushoverNotifier{User: n.PushoverUser, Token: n.PushoverToken, Client: client, Redis: rdb, MonthlyQuota: cfg.PushoverMonthlyQuotaLimit})
+		case "discord":
+			notifiers = append(notifiers, &DiscordNotifier{WebhookURL: n.DiscordWebhookURL, Client: client})
+		case "redis":
+			if rdb == nil {
+				continue
+			}
+			channel := n.RedisChannel
+			if channel == "" {
+				channel = cfg.RedisPubSubChannel
+			}
+			notifiers = append(notifiers, &RedisNotifier{Client: rdb, Channel: channel})
+		}
+	}
+	return notifiers
+}
@@ -0,0 +1,190 @@
+package monitor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"thermostat/proto/nestpb"
+)
+
+// defaultGRPCAlertLimit is how many alerts ListAlertHistory returns when the
+// request doesn't set a limit, as for GET /alerts/{deviceID}.
+const defaultGRPCAlertLimit = 20
+
+// GRPCServer returns a gRPC server for the NestMonitor service in
+// proto/nest.proto, secured with grpc_cert_file and grpc_key_file. With
+// grpc_client_ca_file set, clients must also present a certificate signed by
+// that CA.
+func (m *Monitor) GRPCServer() (*grpc.Server, error) {
+	cfg := m.config()
+	if cfg.GRPCCertFile == "" || cfg.GRPCKeyFile == "" {
+		return nil, errors.New("grpc_cert_file and grpc_key_file must be set to serve gRPC")
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.GRPCCertFile, cfg.GRPCKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading gRPC certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if cfg.GRPCClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.GRPCClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("grpc_client_ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("grpc_client_ca_file: no certificates in %s", cfg.GRPCClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	s := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)))
+	nestpb.RegisterNestMonitorServer(s, &grpcServer{m: m})
+	return s, nil
+}
+
+// grpcServer implements nestpb.NestMonitorServer on top of the same Redis
+// state as the HTTP API.
+type grpcServer struct {
+	nestpb.UnimplementedNestMonitorServer
+	m *Monitor
+}
+
+func (s *grpcServer) GetDeviceStatus(ctx context.Context, req *nestpb.GetDeviceStatusRequest) (*nestpb.DeviceStatus, error) {
+	if req.DeviceId == "" {
+		return nil, status.Error(codes.InvalidArgument, "device_id is required")
+	}
+	n, err := s.m.rdb.Exists(ctx, samplesKey(req.DeviceId)).Result()
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if n == 0 {
+		return nil, status.Errorf(codes.NotFound, "no samples for device %s", req.DeviceId)
+	}
+	state, _, err := s.m.deviceState(ctx, s.m.config(), req.DeviceId)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	resp := &nestpb.DeviceStatus{
+		DeviceId:       state.DeviceID,
+		Alias:          state.Alias,
+		Ambient:        state.Ambient,
+		Heat:           state.Heat,
+		Cool:           state.Cool,
+		HvacState:      state.HvacState,
+		Connectivity:   state.Connectivity,
+		SampleTime:     timestamppb.New(state.SampleTime),
+		AnomalyActive:  state.AnomalyActive,
+		AvailableModes: state.AvailableModes,
+	}
+	if state.LastAlertTime != nil {
+		resp.LastAlertTime = timestamppb.New(*state.LastAlertTime)
+	}
+	return resp, nil
+}
+
+func (s *grpcServer) ListAlertHistory(ctx context.Context, req *nestpb.ListAlertHistoryRequest) (*nestpb.ListAlertHistoryResponse, error) {
+	if req.DeviceId == "" {
+		return nil, status.Error(codes.InvalidArgument, "device_id is required")
+	}
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = defaultGRPCAlertLimit
+	}
+	events, err := s.m.ListAlertHistory(req.DeviceId, limit)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	resp := &nestpb.ListAlertHistoryResponse{Alerts: make([]*nestpb.AlertEvent, len(events))}
+	for i, e := range events {
+		resp.Alerts[i] = alertEventProto(e)
+	}
+	return resp, nil
+}
+
+func (s *grpcServer) TriggerAnomalyCheck(ctx context.Context, req *nestpb.TriggerAnomalyCheckRequest) (*nestpb.TriggerAnomalyCheckResponse, error) {
+	if req.DeviceId == "" {
+		return nil, status.Error(codes.InvalidArgument, "device_id is required")
+	}
+	operator := "grpc"
+	if p, ok := peer.FromContext(ctx); ok {
+		operator += " " + p.Addr.String()
+	}
+	anomaly, err := s.m.CheckDevice(WithOperator(ctx, operator), req.DeviceId)
+	var apiErr *APIError
+	switch {
+	case errors.Is(err, errDeviceNotFound):
+		return nil, status.Errorf(codes.NotFound, "device %s not found", req.DeviceId)
+	case errors.As(err, &apiErr):
+		return nil, status.Errorf(codes.Unavailable, "SDM API returned status %d", apiErr.StatusCode)
+	case err != nil:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &nestpb.TriggerAnomalyCheckResponse{ActiveAnomaly: anomaly}, nil
+}
+
+func (s *grpcServer) StreamAlerts(req *nestpb.StreamAlertsRequest, stream nestpb.NestMonitor_StreamAlertsServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	var sendErr error
+	err := s.m.TailAlerts(ctx, func(e AlertEvent) {
+		if sendErr != nil || (req.DeviceId != "" && e.DeviceID != req.DeviceId) {
+			return
+		}
+		if sendErr = stream.Send(alertEventProto(e)); sendErr != nil {
+			cancel()
+		}
+	})
+	if sendErr != nil {
+		return sendErr
+	}
+	if err != nil && stream.Context().Err() == nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	return nil
+}
+
+func alertEventProto(e AlertEvent) *nestpb.AlertEvent {
+	return &nestpb.AlertEvent{
+		Type:        e.Type,
+		DeviceId:    e.DeviceID,
+		DisplayName: e.DisplayName,
+		Message:     e.Message,
+		Priority:    e.Priority,
+		Time:        timestamppb.New(e.Time),
+		Ambient:     e.Ambient,
+		Simulated:   e.Simulated,
+	}
+}
+
+// CheckDevice fetches one device and processes it as a poll would, then
+// returns its active anomaly type, or "" if it has none.
+func (m *Monitor) CheckDevice(ctx context.Context, deviceID string) (string, error) {
+	token, err := m.tokens.Get(ctx)
+	if err != nil {
+		return "", err
+	}
+	d, err := m.fetchDevice(ctx, token, deviceID)
+	if err != nil {
+		return "", err
+	}
+	if errs := m.processDevices(ctx, []Device{d}, token); len(errs) > 0 {
+		return "", errs[0]
+	}
+	anomaly, err := m.rdb.Get(ctx, activeAnomalyKey(deviceID)).Result()
+	if err != nil && err != redis.Nil {
+		return "", err
+	}
+	return anomaly, nil
+}
@@ -0,0 +1,78 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// setpointGuardFailedAlertInterval is how often a correction that keeps
+// failing is alerted on, rather than on every poll.
+const setpointGuardFailedAlertInterval = time.Hour
+
+// setpointGuardFailedKey exists while a failed correction has been alerted
+// on recently.
+func setpointGuardFailedKey(deviceID string) string {
+	return fmt.Sprintf("nest:%s:setpoint_guard_failed", deviceID)
+}
+
+// guardSetpoints is the setpoint guard: it puts a heat setpoint below
+// setpoint_guard_min_heat_f or a cool setpoint above
+// setpoint_guard_max_cool_f back to that bound, e.g. after an integration
+// set something unsafe, and alerts with the original and corrected values.
+func (m *Monitor) guardSetpoints(ctx context.Context, deviceID string, sample Sample, token string) {
+	cfg := m.config()
+	if deviceID == SimulatedDeviceID || (cfg.SetpointGuardMinHeatF == 0 && cfg.SetpointGuardMaxCoolF == 0) {
+		return
+	}
+	// Work in Fahrenheit to compare, and Celsius to send commands.
+	toF, toC := func(v float64) float64 { return v }, fToC
+	if m.sampleUnit(deviceID) != "FAHRENHEIT" {
+		toF, toC = cToF, func(v float64) float64 { return v }
+	}
+	heatF, coolF := toF(sample.Heat), toF(sample.Cool)
+
+	var heatC, coolC float64
+	if sample.Heat != 0 {
+		heatC = toC(sample.Heat)
+	}
+	if sample.Cool != 0 {
+		coolC = toC(sample.Cool)
+	}
+	var fixes []string
+	if bound := cfg.SetpointGuardMinHeatF; bound != 0 && sample.Heat != 0 && heatF < bound {
+		heatC = fToC(bound)
+		fixes = append(fixes, fmt.Sprintf("heat %.1f°F to %.1f°F", heatF, bound))
+	}
+	if bound := cfg.SetpointGuardMaxCoolF; bound != 0 && sample.Cool != 0 && coolF > bound {
+		coolC = fToC(bound)
+		fixes = append(fixes, fmt.Sprintf("cool %.1f°F to %.1f°F", coolF, bound))
+	}
+	if len(fixes) == 0 {
+		return
+	}
+
+	detail := strings.Join(fixes, ", ")
+	if err := m.restoreSetpoints(ctx, deviceID, heatC, coolC, token); err != nil {
+		m.logger.Error("setpoint guard correction failed", "device_id", deviceID, "correction", detail, "err", err)
+		m.recordEvent(ctx, deviceID, EventSetpointGuard, "failed to correct "+detail+": "+err.Error())
+		msg := "Unsafe setpoint could not be corrected (" + detail + "): " + err.Error()
+		// SetNX only succeeds once per interval, so a correction that keeps
+		// failing doesn't page on every poll.
+		first, err := m.rdb.SetNX(ctx, setpointGuardFailedKey(deviceID), 1, setpointGuardFailedAlertInterval).Result()
+		if err != nil {
+			m.logger.Warn("failed to record setpoint guard alert", "device_id", deviceID, "err", err)
+		}
+		if first || err != nil {
+			m.alert(ctx, AlertSetpointGuard, deviceID, msg)
+		}
+		return
+	}
+	if err := m.rdb.Del(ctx, setpointGuardFailedKey(deviceID)).Err(); err != nil {
+		m.logger.Warn("failed to clear setpoint guard alert", "device_id", deviceID, "err", err)
+	}
+	m.logger.Warn("setpoint guard corrected setpoints", "device_id", deviceID, "correction", detail)
+	m.recordEvent(ctx, deviceID, EventSetpointGuard, "corrected "+detail)
+	m.alert(ctx, AlertSetpointGuard, deviceID, "Unsafe setpoint corrected: "+detail)
+}
@@ -0,0 +1,40 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSetpointGuardFailureAlertsOnce(t *testing.T) {
+	// Cooling to 25.5°C (77.9°F), above the 75°F guard.
+	d := testDevice(t, "dev1", 26, "COOLING", 0)
+	d.Mode, d.Heat, d.Cool = "COOL", 0, 25.5
+	client := &MockThermostatClient{Devices: []Device{d}, CommandErr: errors.New("connection reset")}
+	tm := newTestMonitor(t, testConfig(t, map[string]any{"setpoint_guard_max_cool_f": 75}), client)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		tm.processDevices(ctx, []Device{d}, "token")
+	}
+	if n := len(tm.client.commands()); n != 3 {
+		t.Errorf("sent %d corrections over three polls, want 3", n)
+	}
+	alerts := tm.notifier.ofType(AlertSetpointGuard)
+	if len(alerts) != 1 || !strings.Contains(alerts[0].Message, "could not be corrected") {
+		t.Fatalf("setpoint_guard alerts = %+v, want one failure", alerts)
+	}
+
+	// Once a correction goes through, a later failure alerts again.
+	tm.client.mu.Lock()
+	tm.client.CommandErr = nil
+	tm.client.mu.Unlock()
+	tm.processDevices(ctx, []Device{d}, "token")
+	if tm.redis.Exists(setpointGuardFailedKey("dev1")) {
+		t.Errorf("%s was kept after a successful correction", setpointGuardFailedKey("dev1"))
+	}
+	if n := len(tm.notifier.ofType(AlertSetpointGuard)); n != 2 {
+		t.Errorf("sent %d setpoint_guard alerts after the correction, want 2", n)
+	}
+}
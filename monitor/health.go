@@ -0,0 +1,116 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// accessTokenLifetime is how long Google OAuth access tokens are valid for.
+const accessTokenLifetime = time.Hour
+
+// healthPingTimeout bounds the Redis ping, which would otherwise wait out the
+// reconnect timeout.
+const healthPingTimeout = 5 * time.Second
+
+// HealthChecker periodically checks the monitor's dependencies while it runs
+// in a long-running mode. It alerts once when a check starts failing and
+// again when they all pass.
+type HealthChecker struct {
+	m *Monitor
+
+	// lastToken and lastFetch are the Unix times of the last successful
+	// token refresh and device fetch.
+	lastToken atomic.Int64
+	lastFetch atomic.Int64
+
+	mu       sync.Mutex
+	healthy  bool
+	failures []string
+}
+
+func newHealthChecker(m *Monitor) *HealthChecker {
+	now := time.Now().Unix()
+	h := &HealthChecker{m: m, healthy: true}
+	// Count from startup, so nothing fails before the first refresh is due.
+	h.lastToken.Store(now)
+	h.lastFetch.Store(now)
+	return h
+}
+
+// Health returns the monitor's health checker.
+func (m *Monitor) Health() *HealthChecker {
+	return m.health
+}
+
+// Healthy reports the outcome of the last check, and what failed if
+// anything did. It is true until the first check fails.
+func (h *HealthChecker) Healthy() (bool, []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.healthy, append([]string(nil), h.failures...)
+}
+
+// Run checks every health_check_interval_seconds until ctx is cancelled.
+func (h *HealthChecker) Run(ctx context.Context) {
+	h.m.metrics.healthy.Set(1)
+	for {
+		interval := time.Duration(h.m.config().HealthCheckIntervalSeconds) * time.Second
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		h.check(ctx)
+	}
+}
+
+// check runs every check and alerts on a change in health.
+func (h *HealthChecker) check(ctx context.Context) {
+	cfg := h.m.config()
+	var failures []string
+
+	pingCtx, cancel := context.WithTimeout(ctx, healthPingTimeout)
+	err := h.m.rdb.Ping(pingCtx).Err()
+	cancel()
+	if err != nil {
+		failures = append(failures, "redis: "+err.Error())
+	}
+	if age := sinceUnix(h.lastToken.Load()); age > 2*accessTokenLifetime {
+		failures = append(failures, fmt.Sprintf("no token refresh for %s", age.Round(time.Minute)))
+	}
+	// Long-running modes fetch devices every pubsub_refresh_minutes.
+	fetchInterval := time.Duration(max(cfg.PollIntervalMinutes, cfg.PubSubRefreshMinutes)) * time.Minute
+	if age := sinceUnix(h.lastFetch.Load()); age > 3*fetchInterval {
+		failures = append(failures, fmt.Sprintf("no device fetch for %s", age.Round(time.Minute)))
+	}
+
+	healthy := len(failures) == 0
+	h.mu.Lock()
+	changed := healthy != h.healthy
+	h.healthy, h.failures = healthy, failures
+	h.mu.Unlock()
+
+	if healthy {
+		h.m.metrics.healthy.Set(1)
+	} else {
+		h.m.metrics.healthy.Set(0)
+	}
+	if !changed {
+		return
+	}
+	if healthy {
+		h.m.logger.Info("health checks recovered")
+		h.m.alert(ctx, AlertHealthRecovered, "N/A", "Health checks passing again")
+		return
+	}
+	h.m.logger.Warn("health check failed", "failures", failures)
+	h.m.alert(ctx, AlertHealthCheckFailed, "N/A", "Health check failed: "+strings.Join(failures, "; "))
+}
+
+func sinceUnix(ts int64) time.Duration {
+	return time.Since(time.Unix(ts, 0))
+}
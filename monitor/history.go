@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// hourlyHistoryTTL keeps a day's hourly readings around long enough to be
+// compared against on the following day.
+const hourlyHistoryTTL = 48 * time.Hour
+
+// errNoBaseline means there is no reading for the same hour yesterday.
+var errNoBaseline = errors.New("no reading for the same hour yesterday")
+
+// hourlyKey is the hash of a device's ambient readings on a given day, keyed
+// by hour of day.
+func hourlyKey(deviceID string, day time.Time) string {
+	return fmt.Sprintf("nest:%s:hourly:%s", deviceID, day.Format("2006-01-02"))
+}
+
+// recordHourly queues the latest ambient reading for the current hour on p.
+func recordHourly(ctx context.Context, p redis.Pipeliner, deviceID string, sample Sample) {
+	key := hourlyKey(deviceID, sample.Ts)
+	p.HSet(ctx, key, strconv.Itoa(sample.Ts.Hour()), sample.Ambient)
+	p.Expire(ctx, key, hourlyHistoryTTL)
+}
+
+// compareWithYesterday returns how far currentAmbient is from the reading at
+// the same hour yesterday. It returns errNoBaseline if there is none.
+func compareWithYesterday(ctx context.Context, rdb *RedisPool, deviceID string, currentAmbient float64, cfg *Config) (delta float64, err error) {
+	yesterday := cfg.now().AddDate(0, 0, -1)
+	var prev float64
+	err = rdb.withRetry(ctx, func() error {
+		prev, err = rdb.HGet(ctx, hourlyKey(deviceID, yesterday), strconv.Itoa(yesterday.Hour())).Float64()
+		return err
+	})
+	if err == redis.Nil {
+		return 0, errNoBaseline
+	}
+	if err != nil {
+		return 0, fmt.Errorf("reading yesterday's ambient: %w", err)
+	}
+	return currentAmbient - prev, nil
+}
+
+// historicalNote describes how unusual ambient is compared to the same hour
+// yesterday, or returns "" if the deviation is within
+// HistoricalDeviationThreshold or can't be computed.
+func (m *Monitor) historicalNote(ctx context.Context, deviceID string, ambient float64) string {
+	cfg := m.config().forDevice(deviceID)
+	if cfg.HistoricalDeviationThreshold <= 0 {
+		return ""
+	}
+	delta, err := compareWithYesterday(ctx, m.rdb, deviceID, ambient, cfg)
+	if err != nil {
+		if !errors.Is(err, errNoBaseline) {
+			m.logger.Warn("historical comparison failed", "device_id", deviceID, "err", err)
+		}
+		return ""
+	}
+	if delta < cfg.HistoricalDeviationThreshold && -delta < cfg.HistoricalDeviationThreshold {
+		return ""
+	}
+	return fmt.Sprintf(" [%+.1f° vs same hour yesterday]", delta)
+}
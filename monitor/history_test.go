@@ -0,0 +1,35 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestCompareWithYesterday(t *testing.T) {
+	cfg := testConfig(t, map[string]any{"historical_deviation_threshold": 3})
+	tm := newTestMonitor(t, cfg, nil)
+	ctx := context.Background()
+
+	if _, err := compareWithYesterday(ctx, tm.rdb, "dev1", 20, cfg); !errors.Is(err, errNoBaseline) {
+		t.Errorf("compareWithYesterday without a baseline: err = %v, want errNoBaseline", err)
+	}
+
+	yesterday := cfg.now().AddDate(0, 0, -1)
+	tm.rdb.HSet(ctx, hourlyKey("dev1", yesterday), strconv.Itoa(yesterday.Hour()), 16)
+	delta, err := compareWithYesterday(ctx, tm.rdb, "dev1", 20, cfg)
+	if err != nil || delta != 4 {
+		t.Errorf("compareWithYesterday = %v, %v, want 4", delta, err)
+	}
+	if note := tm.historicalNote(ctx, "dev1", 20); note != " [+4.0° vs same hour yesterday]" {
+		t.Errorf("historicalNote = %q, want the +4.0° deviation", note)
+	}
+
+	// The caller's deadline, e.g. device_process_timeout_seconds, applies.
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := compareWithYesterday(canceled, tm.rdb, "dev1", 20, cfg); !errors.Is(err, context.Canceled) {
+		t.Errorf("compareWithYesterday with a canceled context: err = %v, want context.Canceled", err)
+	}
+}
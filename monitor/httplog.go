@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// redactedHeaders are replaced in logged requests.
+var redactedHeaders = []string{"Authorization", "Cookie", "X-Admin-Token"}
+
+// loggingRoundTripper logs every request sent through it at debug level.
+// doRequest leaves the logging to it when a client has one, so each request
+// is logged once.
+type loggingRoundTripper struct {
+	next   http.RoundTripper
+	logger *slog.Logger
+}
+
+func (t *loggingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	attrs := []any{"method", req.Method, "url", redactURL(req.URL), "headers", redactHeaders(req.Header), "elapsed", time.Since(start)}
+	if err != nil {
+		t.logger.Debug("outbound request failed", append(attrs, "err", err)...)
+		return nil, err
+	}
+	t.logger.Debug("outbound request", append(attrs, responseAttrs(req, resp)...)...)
+	return resp, nil
+}
+
+// logsRequests reports whether client logs every request itself.
+func logsRequests(client *http.Client) bool {
+	_, ok := client.Transport.(*loggingRoundTripper)
+	return ok
+}
+
+// redactURL is u.Redacted() with webhook tokens, which Discord puts in the
+// path (/api/webhooks/{id}/{token}), replaced as well.
+func redactURL(u *url.URL) string {
+	r := *u
+	segs := strings.Split(r.Path, "/")
+	for i, seg := range segs {
+		if seg == "webhooks" && i+2 < len(segs) && segs[i+2] != "" {
+			segs[i+2] = "REDACTED"
+		}
+	}
+	r.Path, r.RawPath = strings.Join(segs, "/"), ""
+	return r.Redacted()
+}
+
+// responseAttrs are the log attributes that tie a response to the request
+// IDs on either side.
+func responseAttrs(req *http.Request, resp *http.Response) []any {
+	attrs := []any{"status", resp.StatusCode}
+	if id := req.Header.Get(requestIDHeader); id != "" {
+		attrs = append(attrs, "request_id", id)
+	}
+	if trace := resp.Header.Get("X-Cloud-Trace-Context"); trace != "" {
+		attrs = append(attrs, "cloud_trace", trace)
+	}
+	if upstream := resp.Header.Get("X-Request-Id"); upstream != "" {
+		attrs = append(attrs, "upstream_request_id", upstream)
+	}
+	return attrs
+}
+
+func redactHeaders(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range redactedHeaders {
+		if h.Get(name) != "" {
+			h.Set(name, "REDACTED")
+		}
+	}
+	return h
+}
+
+// newHTTPClient returns the client shared by the SDM client, token refreshes
+// and notifiers. With log_http_requests set, every request it sends is logged.
+func newHTTPClient(cfg *Config, logger *slog.Logger) *http.Client {
+	if !cfg.LogHTTPRequests {
+		return &http.Client{}
+	}
+	return &http.Client{Transport: &loggingRoundTripper{next: http.DefaultTransport, logger: logger}}
+}
@@ -0,0 +1,183 @@
+package monitor
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// googleCertsURL serves the PEM certificates Google signs its ID tokens with,
+// keyed by key ID.
+const googleCertsURL = "https://www.googleapis.com/oauth2/v1/certs"
+
+// googleCertsTTL is how long fetched certificates are trusted before being
+// fetched again. Google rotates them every few days.
+const googleCertsTTL = time.Hour
+
+// jwtClockSkew is the leeway allowed on token expiry.
+const jwtClockSkew = time.Minute
+
+// googleCertsRefetchInterval is the least time between two fetches of the
+// certificates. A token with an unknown key ID would otherwise make every
+// push request fetch them again.
+const googleCertsRefetchInterval = time.Minute
+
+// googleCerts caches Google's token signing keys.
+type googleCerts struct {
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+	// attempted is when the last fetch started, whether or not it
+	// succeeded.
+	attempted time.Time
+}
+
+// key returns the public key for kid, fetching the certificates again if
+// they're stale or don't include it, but no more than once per
+// googleCertsRefetchInterval. Until then, or if the fetch fails, a stale key
+// is still used.
+func (c *googleCerts) key(ctx context.Context, client *http.Client, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	k, ok := c.keys[kid]
+	if (ok && time.Since(c.fetched) < googleCertsTTL) || time.Since(c.attempted) < googleCertsRefetchInterval {
+		c.mu.Unlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		return k, nil
+	}
+	c.attempted = time.Now()
+	c.mu.Unlock()
+
+	// Fetch without holding the lock, so requests with a known key aren't
+	// held up behind it.
+	keys, err := fetchGoogleCerts(ctx, client)
+	if err != nil {
+		// Google rotates keys slowly, so a stale key still verifies most
+		// tokens while its certs endpoint is unreachable.
+		if ok {
+			return k, nil
+		}
+		return nil, err
+	}
+	c.mu.Lock()
+	c.keys, c.fetched = keys, time.Now()
+	c.mu.Unlock()
+
+	k, ok = keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return k, nil
+}
+
+// fetchGoogleCerts fetches Google's token signing keys, keyed by key ID.
+func fetchGoogleCerts(ctx context.Context, client *http.Client) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", googleCertsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching google certs: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching google certs: status %d", resp.StatusCode)
+	}
+	var pems map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&pems); err != nil {
+		return nil, fmt.Errorf("decoding google certs: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(pems))
+	for id, p := range pems {
+		block, _ := pem.Decode([]byte(p))
+		if block == nil {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+		if k, ok := cert.PublicKey.(*rsa.PublicKey); ok {
+			keys[id] = k
+		}
+	}
+	return keys, nil
+}
+
+type googleIDClaims struct {
+	Issuer        string `json:"iss"`
+	Audience      string `json:"aud"`
+	Expiry        int64  `json:"exp"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// verifyGoogleJWT checks that raw is an RS256 ID token signed by Google for
+// audience and, if email is set, issued to that service account.
+func verifyGoogleJWT(ctx context.Context, certs *googleCerts, client *http.Client, raw, audience, email string) error {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return fmt.Errorf("header: %w", err)
+	}
+	if header.Alg != "RS256" {
+		return fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+
+	key, err := certs.key(ctx, client, header.Kid)
+	if err != nil {
+		return err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("signature: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return errors.New("invalid signature")
+	}
+
+	var claims googleIDClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return fmt.Errorf("claims: %w", err)
+	}
+	switch {
+	case claims.Issuer != "accounts.google.com" && claims.Issuer != "https://accounts.google.com":
+		return fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	case claims.Audience != audience:
+		return fmt.Errorf("unexpected audience %q", claims.Audience)
+	case time.Now().After(time.Unix(claims.Expiry, 0).Add(jwtClockSkew)):
+		return errors.New("token expired")
+	case email != "" && (claims.Email != email || !claims.EmailVerified):
+		return fmt.Errorf("unexpected email %q", claims.Email)
+	}
+	return nil
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,239 @@
+package monitor
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testAudience = "https://monitor.example/push"
+	testKid      = "test-key"
+	testEmail    = "push@test-project.iam.gserviceaccount.com"
+)
+
+// testSigner signs ID tokens with a key it serves as Google's certs.
+type testSigner struct {
+	key     *rsa.PrivateKey
+	certPEM string
+	fetches atomic.Int32
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{key: key, certPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))}
+}
+
+// client serves the signer's certificate under testKid, counting fetches.
+func (s *testSigner) client() *http.Client {
+	return &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		s.fetches.Add(1)
+		body, _ := json.Marshal(map[string]string{testKid: s.certPEM})
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(string(body))),
+			Request:    r,
+		}, nil
+	})}
+}
+
+// sign returns a token with header and claims, signed with the signer's key.
+func (s *testSigner) sign(t *testing.T, header, claims map[string]any) string {
+	t.Helper()
+	enc := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := enc(header) + "." + enc(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"iss":            "https://accounts.google.com",
+		"aud":            testAudience,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"email":          testEmail,
+		"email_verified": true,
+	}
+}
+
+func TestVerifyGoogleJWT(t *testing.T) {
+	signer := newTestSigner(t)
+	header := map[string]any{"alg": "RS256", "kid": testKid}
+	with := func(k string, v any) map[string]any {
+		c := validClaims()
+		c[k] = v
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token func() string
+		want  string
+	}{
+		{
+			name:  "valid",
+			token: func() string { return signer.sign(t, header, validClaims()) },
+		},
+		{
+			name: "alg none",
+			token: func() string {
+				tok := signer.sign(t, map[string]any{"alg": "none", "kid": testKid}, validClaims())
+				return tok[:strings.LastIndex(tok, ".")+1]
+			},
+			want: "unsupported algorithm",
+		},
+		{
+			name:  "alg HS256",
+			token: func() string { return signer.sign(t, map[string]any{"alg": "HS256", "kid": testKid}, validClaims()) },
+			want:  "unsupported algorithm",
+		},
+		{
+			name: "bad signature",
+			token: func() string {
+				tok := signer.sign(t, header, validClaims())
+				other := signer.sign(t, header, with("email", "other@example.com"))
+				return tok[:strings.LastIndex(tok, ".")] + other[strings.LastIndex(other, "."):]
+			},
+			want: "invalid signature",
+		},
+		{
+			name:  "wrong audience",
+			token: func() string { return signer.sign(t, header, with("aud", "https://other.example")) },
+			want:  "unexpected audience",
+		},
+		{
+			name:  "wrong issuer",
+			token: func() string { return signer.sign(t, header, with("iss", "https://evil.example")) },
+			want:  "unexpected issuer",
+		},
+		{
+			name:  "expired",
+			token: func() string { return signer.sign(t, header, with("exp", time.Now().Add(-2*jwtClockSkew).Unix())) },
+			want:  "token expired",
+		},
+		{
+			name:  "unverified email",
+			token: func() string { return signer.sign(t, header, with("email_verified", false)) },
+			want:  "unexpected email",
+		},
+		{
+			name: "unknown kid",
+			token: func() string {
+				return signer.sign(t, map[string]any{"alg": "RS256", "kid": "rotated-out"}, validClaims())
+			},
+			want: "unknown signing key",
+		},
+		{
+			name:  "malformed",
+			token: func() string { return "not-a-token" },
+			want:  "malformed token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var certs googleCerts
+			err := verifyGoogleJWT(context.Background(), &certs, signer.client(), tt.token(), testAudience, testEmail)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("verifyGoogleJWT: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("verifyGoogleJWT error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoogleCertsRefetchIsRateLimited(t *testing.T) {
+	signer := newTestSigner(t)
+	client := signer.client()
+	var certs googleCerts
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if _, err := certs.key(ctx, client, "rotated-out"); err == nil {
+			t.Fatal("key for an unknown kid succeeded")
+		}
+	}
+	if n := signer.fetches.Load(); n != 1 {
+		t.Errorf("fetched certs %d times for repeated unknown kids, want 1", n)
+	}
+	if _, err := certs.key(ctx, client, testKid); err != nil {
+		t.Errorf("key for a known kid: %v", err)
+	}
+
+	// Once the interval has passed, an unknown kid fetches again, e.g. to
+	// pick up a newly rotated key.
+	certs.mu.Lock()
+	certs.attempted = time.Now().Add(-googleCertsRefetchInterval)
+	certs.mu.Unlock()
+	certs.key(ctx, client, "rotated-out")
+	if n := signer.fetches.Load(); n != 2 {
+		t.Errorf("fetched certs %d times after the interval, want 2", n)
+	}
+}
+
+func TestGoogleCertsFallsBackToStaleKey(t *testing.T) {
+	signer := newTestSigner(t)
+	var certs googleCerts
+	ctx := context.Background()
+	if _, err := certs.key(ctx, signer.client(), testKid); err != nil {
+		t.Fatalf("key: %v", err)
+	}
+
+	// The certs go stale and the endpoint is down.
+	certs.mu.Lock()
+	certs.fetched = time.Now().Add(-googleCertsTTL)
+	certs.attempted = time.Now().Add(-googleCertsRefetchInterval)
+	certs.mu.Unlock()
+	down := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})}
+	if k, err := certs.key(ctx, down, testKid); err != nil || k == nil {
+		t.Errorf("key with the endpoint down = %v, %v, want the stale key", k, err)
+	}
+	if _, err := certs.key(ctx, down, "rotated-out"); err == nil {
+		t.Error("key for an unknown kid succeeded with the endpoint down")
+	}
+}
@@ -0,0 +1,70 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+)
+
+const thermostatLockTrait = "sdm.devices.traits.ThermostatLock"
+
+// LockThermostat restricts the setpoints users can choose on the device to
+// minC-maxC, in Celsius.
+func (m *Monitor) LockThermostat(ctx context.Context, deviceID string, minC, maxC float64) error {
+	if minC >= maxC {
+		return fmt.Errorf("min (%.1f°C) must be below max (%.1f°C)", minC, maxC)
+	}
+	if !isPlausibleTemperature(minC, "CELSIUS") || !isPlausibleTemperature(maxC, "CELSIUS") {
+		return fmt.Errorf("lock range %.1f-%.1f°C is outside the plausible range", minC, maxC)
+	}
+	token, err := m.tokens.Get(ctx)
+	if err != nil {
+		return err
+	}
+	return m.lockThermostat(ctx, deviceID, minC, maxC, token)
+}
+
+// UnlockThermostat lifts any setpoint lock on the device.
+func (m *Monitor) UnlockThermostat(ctx context.Context, deviceID string) error {
+	token, err := m.tokens.Get(ctx)
+	if err != nil {
+		return err
+	}
+	err = m.setLock(ctx, deviceID, token, map[string]any{"locked": false})
+	if err != nil {
+		m.logger.Error("unlock failed", "device_id", deviceID, "err", err)
+		m.alert(ctx, AlertLockFailed, deviceID, "Failed to unlock thermostat: "+err.Error())
+		return err
+	}
+	m.logger.Info("thermostat unlocked", "device_id", deviceID)
+	m.alert(ctx, AlertUnlockSuccess, deviceID, "Thermostat unlocked")
+	return nil
+}
+
+func (m *Monitor) lockThermostat(ctx context.Context, deviceID string, minC, maxC float64, token string) error {
+	err := m.setLock(ctx, deviceID, token, map[string]any{
+		"locked":                true,
+		"minTemperatureCelsius": minC,
+		"maxTemperatureCelsius": maxC,
+	})
+	if err != nil {
+		m.logger.Error("lock failed", "device_id", deviceID, "err", err)
+		m.alert(ctx, AlertLockFailed, deviceID, "Failed to lock thermostat: "+err.Error())
+		return err
+	}
+	m.logger.Info("thermostat locked", "device_id", deviceID, "min_celsius", minC, "max_celsius", maxC)
+	m.alert(ctx, AlertLockSuccess, deviceID, fmt.Sprintf("Thermostat locked to %.1f-%.1f°C", minC, maxC))
+	return nil
+}
+
+// setLock sends a lock command, after checking the device has the lock
+// trait; only some models do.
+func (m *Monitor) setLock(ctx context.Context, deviceID, token string, params map[string]any) error {
+	d, err := m.fetchDevice(ctx, token, deviceID)
+	if err != nil {
+		return err
+	}
+	if _, ok := d.Traits[thermostatLockTrait]; !ok {
+		return fmt.Errorf("device %s does not support locking", deviceID)
+	}
+	return m.executeCommand(ctx, deviceID, "sdm.devices.commands.ThermostatLock.SetLock", params, token)
+}
@@ -0,0 +1,150 @@
+package monitor
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics holds the Prometheus collectors for a Monitor, on a registry of its
+// own so several Monitors can live in one process.
+type metrics struct {
+	registry *prometheus.Registry
+
+	ambient *prometheus.GaugeVec
+	heat    *prometheus.GaugeVec
+	cool    *prometheus.GaugeVec
+	info    *prometheus.GaugeVec
+	healthy prometheus.Gauge
+
+	deviceErrors  *prometheus.CounterVec
+	redisDuration *prometheus.HistogramVec
+	fanRuntime    *prometheus.GaugeVec
+
+	mu sync.Mutex
+	// infoLabels is the label set each device's info series was last
+	// published with, so a stale series can be removed when it changes.
+	infoLabels map[string]prometheus.Labels
+}
+
+func newMetrics() *metrics {
+	mt := &metrics{
+		registry: prometheus.NewRegistry(),
+		ambient: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nest_thermostat_ambient_temperature",
+			Help: "Latest ambient temperature, in the device's display unit.",
+		}, []string{"device_id"}),
+		heat: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nest_thermostat_heat_setpoint",
+			Help: "Heat setpoint, in the device's display unit; 0 when not in use.",
+		}, []string{"device_id"}),
+		cool: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nest_thermostat_cool_setpoint",
+			Help: "Cool setpoint, in the device's display unit; 0 when not in use.",
+		}, []string{"device_id"}),
+		info: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nest_thermostat_info",
+			Help: "Always 1; labels describe the device, for joining onto other metrics.",
+		}, []string{"device_id", "display_name", "model", "room", "group"}),
+		healthy: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "nest_monitor_healthy",
+			Help: "1 if the last health check passed, 0 if it failed.",
+		}),
+		deviceErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "nest_device_errors_total",
+			Help: "Polls in which a device's sample couldn't be processed.",
+		}, []string{"device_id"}),
+		redisDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "nest_redis_operation_duration_seconds",
+			Help:    "Time taken by Redis commands and pipelines, by command and device.",
+			Buckets: prometheus.ExponentialBucketsRange(0.0001, 1, 9),
+		}, []string{"operation", "device_id"}),
+		fanRuntime: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "nest_fan_runtime_seconds_today",
+			Help: "Seconds the fan has run today, apart from heating or cooling.",
+		}, []string{"device_id"}),
+		infoLabels: map[string]prometheus.Labels{},
+	}
+	goroutines := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "nest_goroutines",
+		Help: "Goroutines in the process; steady growth points to a leak.",
+	}, func() float64 { return float64(runtime.NumGoroutine()) })
+	mt.registry.MustRegister(mt.ambient, mt.heat, mt.cool, mt.info, mt.healthy, mt.deviceErrors, mt.redisDuration, mt.fanRuntime, goroutines)
+	return mt
+}
+
+// observe publishes a device's latest readings and metadata.
+func (mt *metrics) observe(d *Device, cfg *Config) {
+	mt.ambient.WithLabelValues(d.ID).Set(d.Ambient)
+	mt.heat.WithLabelValues(d.ID).Set(d.Heat)
+	mt.cool.WithLabelValues(d.ID).Set(d.Cool)
+
+	labels := prometheus.Labels{
+		"device_id":    d.ID,
+		"display_name": cfg.DeviceAliases[d.ID],
+		"model":        d.CustomName,
+		"room":         d.Room,
+		"group":        "",
+	}
+	if g := cfg.groupOf(d.ID); g != nil {
+		labels["group"] = g.Name
+	}
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	if old, ok := mt.infoLabels[d.ID]; ok && !equalLabels(old, labels) {
+		mt.info.Delete(old)
+	}
+	mt.infoLabels[d.ID] = labels
+	mt.info.With(labels).Set(1)
+}
+
+func equalLabels(a, b prometheus.Labels) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// fileResponseWriter lets promhttp write the exposition to a file.
+type fileResponseWriter struct {
+	f      *os.File
+	header http.Header
+	status int
+}
+
+func (w *fileResponseWriter) Header() http.Header         { return w.header }
+func (w *fileResponseWriter) Write(b []byte) (int, error) { return w.f.Write(b) }
+func (w *fileResponseWriter) WriteHeader(status int)      { w.status = status }
+
+// writeSnapshot writes the current metrics to path in the Prometheus text
+// format, for node_exporter's textfile collector. It writes to path.tmp and
+// renames it into place, so the collector never reads a partial file.
+func (mt *metrics) writeSnapshot(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	w := &fileResponseWriter{f: f, header: http.Header{}, status: http.StatusOK}
+	promhttp.HandlerFor(mt.registry, promhttp.HandlerOpts{}).ServeHTTP(w, req)
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if w.status != http.StatusOK {
+		os.Remove(tmp)
+		return fmt.Errorf("gathering metrics failed with status %d", w.status)
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,92 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// KeyMigrationReport counts what MigrateKeysV1ToV2 did.
+type KeyMigrationReport struct {
+	Found    int `json:"found"`
+	Migrated int `json:"migrated"`
+	// Skipped keys already had a counterpart in the namespace.
+	Skipped int `json:"skipped"`
+}
+
+// namespacedSamplesKey is a device's sample list under the v2 layout,
+// nest:<namespace>:<device id>:temps.
+func namespacedSamplesKey(namespace, deviceID string) string {
+	return fmt.Sprintf("nest:%s:%s:temps", namespace, deviceID)
+}
+
+// MigrateKeysV1ToV2 copies each device's sample list from nest:<id>:temps to
+// nest:<namespace>:<id>:temps, keeping its TTL. Lists that already exist in
+// the namespace are left alone. With deleteOld, the v1 key is deleted once
+// its copy is written.
+func (m *Monitor) MigrateKeysV1ToV2(ctx context.Context, namespace string, deleteOld bool) (KeyMigrationReport, error) {
+	var report KeyMigrationReport
+	if namespace == "" || strings.Contains(namespace, ":") {
+		return report, fmt.Errorf("invalid namespace %q", namespace)
+	}
+
+	iter := m.rdb.Scan(ctx, 0, samplesKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		oldKey := iter.Val()
+		deviceID := strings.TrimSuffix(strings.TrimPrefix(oldKey, "nest:"), ":temps")
+		if strings.Contains(deviceID, ":") {
+			// Already namespaced.
+			continue
+		}
+		report.Found++
+
+		newKey := namespacedSamplesKey(namespace, deviceID)
+		exists, err := m.rdb.Exists(ctx, newKey).Result()
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", newKey, err)
+		}
+		if exists > 0 {
+			m.logger.Info("skipping key, already migrated", "key", oldKey, "new_key", newKey)
+			report.Skipped++
+			continue
+		}
+
+		var entries *redis.StringSliceCmd
+		var ttl *redis.DurationCmd
+		_, err = m.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+			entries = p.LRange(ctx, oldKey, 0, -1)
+			ttl = p.PTTL(ctx, oldKey)
+			return nil
+		})
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", oldKey, err)
+		}
+		values := make([]any, len(entries.Val()))
+		for i, e := range entries.Val() {
+			values[i] = e
+		}
+		if len(values) == 0 {
+			// Expired or emptied since the scan.
+			continue
+		}
+
+		_, err = m.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.RPush(ctx, newKey, values...)
+			if d := ttl.Val(); d > 0 {
+				p.PExpire(ctx, newKey, d)
+			}
+			if deleteOld {
+				p.Del(ctx, oldKey)
+			}
+			return nil
+		})
+		if err != nil {
+			return report, fmt.Errorf("%s: %w", oldKey, err)
+		}
+		m.logger.Info("migrated key", "key", oldKey, "new_key", newKey, "entries", len(values), "deleted_old", deleteOld)
+		report.Migrated++
+	}
+	return report, iter.Err()
+}
@@ -0,0 +1,409 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/errgroup"
+)
+
+// emptyDeviceListWait is how long getDevices waits before asking for the
+// device list again after an empty response. Tests shorten it.
+var emptyDeviceListWait = 10 * time.Second
+
+// Monitor holds everything a poll cycle needs: the active config, the Redis
+// client, the SDM API client, the HTTP client used for other outbound calls,
+// the logger and the notifiers alerts are delivered to.
+type Monitor struct {
+	configs    *configStore
+	rdb        *RedisPool
+	client     ThermostatClient
+	httpClient *http.Client
+	logger     *slog.Logger
+	notifiers  []Notifier
+	audit      AuditLogger
+	metrics    *metrics
+	traits     *deviceTraits
+	tokens     *TokenManager
+	certs      googleCerts
+	health     *HealthChecker
+	watchdog   *Watchdog
+	dryRun     bool
+	profile    bool
+	// device, if set, is the only device processDevices handles.
+	device string
+	// debugSamples, if set, prints each poll's samples as a table.
+	debugSamples *sampleTable
+}
+
+// New returns a Monitor that alerts through every notifier configured in cfg.
+// rdb may be nil for operations that don't touch Redis, such as ListDevices.
+// It is shorthand for NewMonitor with WithConfig, WithRedisClient and
+// WithLogger.
+func New(cfg *Config, rdb *redis.Client, logger *slog.Logger) (*Monitor, error) {
+	return NewMonitor(WithConfig(cfg), WithRedisClient(rdb), WithLogger(logger))
+}
+
+func newMonitor(o options) *Monitor {
+	configs := newConfigStore(o.cfg)
+	m := &Monitor{
+		configs:    configs,
+		client:     o.client,
+		httpClient: o.httpClient,
+		logger:     o.logger,
+		notifiers:  o.notifiers,
+		audit:      o.audit,
+		metrics:    newMetrics(),
+		traits:     newDeviceTraits(),
+		tokens:     newTokenManager(configs, o.httpClient, o.logger),
+		dryRun:     o.dryRun,
+		profile:    o.profile,
+		device:     o.device,
+	}
+	if o.debugSamples != nil {
+		m.debugSamples = &sampleTable{w: o.debugSamples}
+	}
+	m.health = newHealthChecker(m)
+	m.watchdog = newWatchdog(m)
+	m.tokens.OnRefresh = func() { m.health.lastToken.Store(time.Now().Unix()) }
+	m.tokens.OnError = func(ctx context.Context, attempts int, err error) {
+		m.logger.Error("token refresh failed", "attempts", attempts, "err", err)
+		m.alert(ctx, AlertTokenError, "N/A", fmt.Sprintf("Token error after %d attempts: %s", attempts, err))
+	}
+	if o.rdb != nil {
+		o.rdb.AddHook(redisTimingHook{mt: m.metrics})
+		m.rdb = &RedisPool{
+			Client:  o.rdb,
+			Timeout: time.Duration(o.cfg.RedisReconnectTimeoutSeconds) * time.Second,
+			Logger:  o.logger,
+			OnDown: func(ctx context.Context, err error) {
+				m.logger.Error("redis unreachable", "addr", m.config().RedisAddr, "err", err)
+				m.alert(ctx, AlertRedisError, "N/A", "Redis unreachable: "+err.Error())
+			},
+		}
+	}
+	return m
+}
+
+func (m *Monitor) config() *Config {
+	return m.configs.Load()
+}
+
+// CheckRedis verifies that Redis is reachable and new enough, alerting if it
+// isn't.
+func (m *Monitor) CheckRedis(ctx context.Context) error {
+	err := m.rdb.withRetry(ctx, func() error {
+		return m.rdb.Ping(ctx).Err()
+	})
+	if err != nil && !isConnError(err) {
+		// Connection failures have already been alerted by the pool.
+		cfg := m.config()
+		m.logger.Error("failed to connect to redis", "addr", cfg.RedisAddr, "err", err)
+		m.alert(ctx, AlertRedisError, "N/A", "Failed to connect to Redis")
+	}
+	if err != nil {
+		return err
+	}
+	if err := checkRedisVersion(ctx, m.rdb.Client, minRedisVersion); err != nil {
+		m.logger.Error("unsupported redis", "addr", m.config().RedisAddr, "err", err)
+		m.alert(ctx, AlertRedisError, "N/A", "Unsupported Redis: "+err.Error())
+		return err
+	}
+	return nil
+}
+
+// Run executes one full poll cycle: send any escalation steps that have come
+// due, refresh the access token, fetch every device and check its samples
+// for anomalies.
+func (m *Monitor) Run(ctx context.Context) error {
+	if err := m.processEscalations(ctx); err != nil {
+		m.logger.Error("failed to process escalations", "err", err)
+	}
+	token, err := m.tokens.Get(ctx)
+	if err != nil {
+		return err
+	}
+	devices, err := m.getDevices(ctx, token)
+	if err != nil {
+		return err
+	}
+	// The fetch replaces the token if the API rejected it.
+	if token, err = m.tokens.Get(ctx); err != nil {
+		return err
+	}
+	var errs []error
+	for _, de := range m.processDevices(ctx, devices, token) {
+		errs = append(errs, de)
+	}
+	return errors.Join(errs...)
+}
+
+func (m *Monitor) getDevices(ctx context.Context, token string) ([]Device, error) {
+	devices, err := m.fetchDevicesCached(ctx, token)
+	for attempt := 1; errors.Is(err, ErrNoDevices); attempt++ {
+		cfg := m.config()
+		if attempt > cfg.EmptyDeviceListRetries {
+			m.logger.Error("no devices found", "project_id", cfg.ProjectID, "attempts", attempt)
+			m.alert(ctx, AlertNoDevices, "N/A", "No devices found")
+			return nil, err
+		}
+		m.logger.Warn("device list empty, retrying", "attempt", attempt, "wait", emptyDeviceListWait)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(emptyDeviceListWait):
+		}
+		devices, err = m.fetchDevicesCached(ctx, token)
+	}
+	if err != nil {
+		m.logger.Error("failed to fetch devices", "err", err)
+		m.alert(ctx, AlertFetchError, "N/A", "Fetch error:"+err.Error())
+		return nil, err
+	}
+	m.health.lastFetch.Store(time.Now().Unix())
+	return devices, nil
+}
+
+func (m *Monitor) handleDeviceSamples(ctx context.Context, deviceID string, sample Sample, token string) error {
+	window := int64(m.config().SampleWindow)
+	sample.Ts = sample.Ts.In(m.config().Location())
+	err := m.rdb.withRetry(ctx, func() error {
+		return m.trackSetpoints(ctx, deviceID, sample)
+	})
+	if err != nil {
+		return err
+	}
+	m.guardSetpoints(ctx, deviceID, sample, token)
+
+	err = m.rdb.withRetry(ctx, func() error {
+		return m.checkSeasonalMode(ctx, deviceID, sample)
+	})
+	if err != nil {
+		return fmt.Errorf("checking seasonal mode: %w", err)
+	}
+
+	err = m.rdb.withRetry(ctx, func() error {
+		return m.checkScheduleDeviation(ctx, deviceID, sample)
+	})
+	if err != nil {
+		return fmt.Errorf("checking schedule: %w", err)
+	}
+
+	err = m.rdb.withRetry(ctx, func() error {
+		return m.checkRestorePending(ctx, deviceID, sample, token)
+	})
+	if err != nil {
+		return fmt.Errorf("checking auto-restore: %w", err)
+	}
+
+	key := samplesKey(deviceID)
+
+	data, err := encodeSample(m.config().RedisSampleEncoding, sample)
+	if err != nil {
+		return fmt.Errorf("encoding sample: %w", err)
+	}
+	// Every write for the sample and the read of its window share one
+	// transaction, so storing a sample costs a single round trip rather than
+	// one per command (12 to 14, depending on which setpoints are in use).
+	// The whole of handleDeviceSamples makes 6 round trips per sample instead
+	// of 19; see BenchmarkHandleDeviceSamples.
+	//
+	// The writes aren't idempotent, so a retry first checks the transaction's
+	// stored key: if the connection dropped after Redis applied it, the
+	// sample is already stored and only its window is read again.
+	stored := sampleStoredKey(deviceID, sample.Ts)
+	var lrange *redis.StringSliceCmd
+	retrying := false
+	err = m.rdb.withRetry(ctx, func() error {
+		if retrying {
+			n, err := m.rdb.Exists(ctx, stored).Result()
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				lrange = m.rdb.LRange(ctx, key, 0, window-1)
+				return lrange.Err()
+			}
+		}
+		retrying = true
+		_, err := m.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+			p.LPush(ctx, key, data)
+			p.LTrim(ctx, key, 0, window-1)
+			lrange = p.LRange(ctx, key, 0, window-1)
+			recordHourly(ctx, p, deviceID, sample)
+			recordTimeSeriesPoint(ctx, p, deviceID, sample, m.config().RetentionDays)
+			recordFanRuntime(ctx, p, deviceID, sample, time.Duration(m.config().PollIntervalMinutes)*time.Minute)
+			p.Set(ctx, stored, 1, sampleStoredTTL)
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("storing sample: %w", err)
+	}
+	m.logger.Debug("stored sample", "device_id", deviceID, "ambient", sample.Ambient, "hvac_state", sample.HvacState, "heat", sample.Heat, "cool", sample.Cool)
+
+	if err := m.checkFanRuntime(ctx, deviceID, sample); err != nil {
+		m.logger.Warn("failed to check fan runtime", "device_id", deviceID, "err", err)
+	}
+
+	samples := decodeSamples(lrange.Val())
+	if len(samples) > 1 {
+		m.recordStateChanges(ctx, deviceID, samples[1], sample)
+	}
+	err = m.rdb.withRetry(ctx, func() error {
+		return m.checkSilence(ctx, deviceID, sample, samples)
+	})
+	if err != nil {
+		return fmt.Errorf("checking for a frozen sensor: %w", err)
+	}
+	maxAge := time.Duration(m.config().MaxSampleAgeMinutes) * time.Minute
+	if fresh := freshSamples(samples, sample.Ts, maxAge); len(fresh) < len(samples) {
+		m.logger.Debug("discarded stale samples", "device_id", deviceID, "stale", len(samples)-len(fresh), "max_age", maxAge)
+		samples = fresh
+	}
+	m.checkSuddenDrop(ctx, deviceID, samples)
+	if int64(len(samples)) < window {
+		if int64(len(lrange.Val())) >= window {
+			m.logger.Debug("too few fresh samples, skipping anomaly detection", "device_id", deviceID, "fresh", len(samples), "window", window)
+		}
+		return nil
+	}
+	if gap := staleGap(samples, m.config().maxSampleGap()); gap > 0 {
+		m.logger.Warn("stale_data: skipping trend check", "device_id", deviceID, "gap", gap.Round(time.Second))
+		return nil
+	}
+	return m.rdb.withRetry(ctx, func() error {
+		return m.checkAnomaly(ctx, deviceID, samples, token)
+	})
+}
+
+// processDevices handles every device concurrently, at most
+// MaxConcurrentDevices at a time. A failure on one device is logged, counted
+// and returned, and doesn't stop the others.
+func (m *Monitor) processDevices(ctx context.Context, devices []Device, token string) []DeviceError {
+	m.traits.seed(devices)
+	var g errgroup.Group
+	g.SetLimit(m.config().MaxConcurrentDevices)
+	var mu sync.Mutex
+	var deviceErrs []DeviceError
+	for i := range devices {
+		d := &devices[i]
+		g.Go(func() error {
+			if err := m.processDevice(ctx, d, token); err != nil {
+				mu.Lock()
+				deviceErrs = append(deviceErrs, DeviceError{DeviceID: d.ID, Err: err})
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	g.Wait()
+	if m.debugSamples != nil {
+		m.debugSamples.flush()
+	}
+	m.recordPoll(ctx)
+	if path := m.config().PrometheusSnapshotPath; path != "" {
+		if err := m.metrics.writeSnapshot(path); err != nil {
+			m.logger.Error("failed to write metrics snapshot", "path", path, "err", err)
+		}
+	}
+	return deviceErrs
+}
+
+// processDevice runs every check on one device's latest state, whether it
+// came from a poll, a Pub/Sub message or a push delivery. Devices other than
+// the one given to WithDeviceFilter, and implausible readings, are skipped
+// without error. A failure is logged and counted towards device_error, and
+// returned.
+func (m *Monitor) processDevice(ctx context.Context, d *Device, token string) error {
+	if !matchesDevice(d, m.device) {
+		return nil
+	}
+	m.applyForcedUnit(d)
+	if !m.plausible(d) {
+		return nil
+	}
+	cfg := m.config()
+	m.metrics.observe(d, cfg)
+
+	// Bound the device's Redis and API calls, so one slow device can't hold
+	// up the poll.
+	start := time.Now()
+	dctx, cancel := context.WithTimeout(ctx, time.Duration(cfg.DeviceProcessTimeoutSeconds)*time.Second)
+	defer cancel()
+
+	trusted, err := m.checkTraitSignatures(dctx, d)
+	if err != nil {
+		m.logger.Warn("failed to check trait signatures", "device_id", d.ID, "err", err)
+	}
+	if !trusted {
+		return nil
+	}
+	if err := m.checkNewDevice(dctx, d); err != nil {
+		m.logger.Warn("failed to check for a new device", "device_id", d.ID, "err", err)
+	}
+	if err := m.recordDeviceInfo(dctx, d); err != nil {
+		m.logger.Warn("failed to record device info", "device_id", d.ID, "err", err)
+	}
+	err = m.handleDeviceSamples(dctx, d.ID, d.sample(), token)
+	if err != nil {
+		if errors.Is(dctx.Err(), context.DeadlineExceeded) {
+			m.logger.Warn("device processing timed out", "device_id", d.ID, "elapsed", time.Since(start).Round(time.Millisecond))
+		}
+		m.logger.Error("failed to process device", "device_id", d.ID, "err", err)
+		m.trackDeviceError(ctx, DeviceError{DeviceID: d.ID, Err: err})
+	} else {
+		m.clearDeviceErrors(ctx, d.ID)
+	}
+	if m.debugSamples != nil {
+		m.recordDebugSample(ctx, d)
+	}
+	return err
+}
+
+// applyForcedUnit converts d to the configured force_unit, if any.
+func (m *Monitor) applyForcedUnit(d *Device) {
+	unit := m.config().forcedUnit()
+	if unit == "" {
+		return
+	}
+	if from := d.Unit; d.forceUnit(unit) {
+		m.logger.Debug("converted temperatures (forced)", "device_id", d.ID, "from", from, "to", unit)
+	}
+}
+
+// plausible reports whether d's readings are worth storing. A missing
+// temperature trait parses as 0 and an out-of-range value is a sensor or
+// parse fault; either would feed the trend checks bogus data.
+func (m *Monitor) plausible(d *Device) bool {
+	if _, ok := d.Traits["sdm.devices.traits.Temperature"]; !ok {
+		m.logger.Warn("skipping sample without an ambient temperature", "device_id", d.ID)
+		return false
+	}
+	readings := []struct {
+		name  string
+		value float64
+	}{
+		{"ambient", d.Ambient},
+		{"heat", d.Heat},
+		{"cool", d.Cool},
+	}
+	for _, r := range readings {
+		if r.name != "ambient" && r.value == 0 {
+			// Setpoint not used in the current mode.
+			continue
+		}
+		if !isPlausibleTemperature(r.value, d.Unit) {
+			m.logger.Warn("skipping implausible sample", "device_id", d.ID, "reading", r.name, "value", r.value, "unit", d.Unit)
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,273 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestProcessDevicesStoresSample(t *testing.T) {
+	d := testDevice(t, "dev1", 21.5, "OFF", 20)
+	tm := newTestMonitor(t, testConfig(t, nil), &MockThermostatClient{Devices: []Device{d}})
+
+	if errs := tm.processDevices(context.Background(), []Device{d}, "token"); len(errs) > 0 {
+		t.Fatalf("processDevices: %v", errs)
+	}
+
+	samples := tm.storedSamples(t, "dev1")
+	if len(samples) != 1 {
+		t.Fatalf("stored %d samples, want 1", len(samples))
+	}
+	if got := samples[0]; got.Ambient != 21.5 || got.Heat != 20 || got.HvacState != "OFF" {
+		t.Errorf("stored sample = %+v, want ambient 21.5, heat 20, hvac OFF", got)
+	}
+	if cmds := tm.client.commands(); len(cmds) != 0 {
+		t.Errorf("sent commands %+v, want none", cmds)
+	}
+}
+
+func TestHeatingFailureTurnsThermostatOff(t *testing.T) {
+	d := testDevice(t, "dev1", 19, "HEATING", 22)
+	tm := newTestMonitor(t, testConfig(t, nil), &MockThermostatClient{Devices: []Device{d}})
+	tm.seedSamples(t, "dev1",
+		Sample{Ambient: 19.5, HvacState: "HEATING", Heat: 22, Ts: minutesAgo(10)},
+		Sample{Ambient: 20, HvacState: "HEATING", Heat: 22, Ts: minutesAgo(20)},
+	)
+
+	if errs := tm.processDevices(context.Background(), []Device{d}, "token"); len(errs) > 0 {
+		t.Fatalf("processDevices: %v", errs)
+	}
+
+	if alerts := tm.notifier.ofType(AlertHeatingFalling); len(alerts) != 1 {
+		t.Fatalf("sent %d %s alerts, want 1", len(alerts), AlertHeatingFalling)
+	}
+	cmds := tm.client.commands()
+	if len(cmds) != 1 || cmds[0].Command != "sdm.devices.commands.ThermostatMode.SetMode" || cmds[0].Params["mode"] != "OFF" {
+		t.Fatalf("sent commands %+v, want one SetMode OFF", cmds)
+	}
+	if alerts := tm.notifier.ofType(AlertTurnOffSuccess); len(alerts) != 1 {
+		t.Errorf("sent %d %s alerts, want 1", len(alerts), AlertTurnOffSuccess)
+	}
+
+	// The anomaly is still active on the next poll, so it doesn't alert
+	// again.
+	d = testDevice(t, "dev1", 18.5, "HEATING", 22)
+	tm.processDevices(context.Background(), []Device{d}, "token")
+	if alerts := tm.notifier.ofType(AlertHeatingFalling); len(alerts) != 1 {
+		t.Errorf("sent %d %s alerts after a second poll, want 1", len(alerts), AlertHeatingFalling)
+	}
+}
+
+func TestFailedTurnOffAlerts(t *testing.T) {
+	d := testDevice(t, "dev1", 19, "HEATING", 22)
+	client := &MockThermostatClient{Devices: []Device{d}, CommandErr: errors.New("connection reset")}
+	tm := newTestMonitor(t, testConfig(t, nil), client)
+	tm.seedSamples(t, "dev1",
+		Sample{Ambient: 19.5, HvacState: "HEATING", Heat: 22, Ts: minutesAgo(10)},
+		Sample{Ambient: 20, HvacState: "HEATING", Heat: 22, Ts: minutesAgo(20)},
+	)
+
+	tm.processDevices(context.Background(), []Device{d}, "token")
+
+	if alerts := tm.notifier.ofType(AlertTurnOffFailed); len(alerts) != 1 {
+		t.Errorf("sent %d %s alerts, want 1", len(alerts), AlertTurnOffFailed)
+	}
+}
+
+func TestNoAnomalyWithoutAFullWindow(t *testing.T) {
+	d := testDevice(t, "dev1", 19, "HEATING", 22)
+	tm := newTestMonitor(t, testConfig(t, nil), &MockThermostatClient{Devices: []Device{d}})
+	tm.seedSamples(t, "dev1", Sample{Ambient: 20, HvacState: "HEATING", Heat: 22, Ts: minutesAgo(10)})
+
+	tm.processDevices(context.Background(), []Device{d}, "token")
+
+	if alerts := tm.notifier.ofType(AlertHeatingFalling); len(alerts) != 0 {
+		t.Errorf("sent %d %s alerts with two samples, want none", len(alerts), AlertHeatingFalling)
+	}
+	if cmds := tm.client.commands(); len(cmds) != 0 {
+		t.Errorf("sent commands %+v, want none", cmds)
+	}
+}
+
+func TestStaleSamplesAreIgnored(t *testing.T) {
+	d := testDevice(t, "dev1", 19, "HEATING", 22)
+	tm := newTestMonitor(t, testConfig(t, nil), &MockThermostatClient{Devices: []Device{d}})
+	// Left over from before the monitor was down for a day.
+	tm.seedSamples(t, "dev1",
+		Sample{Ambient: 19.5, HvacState: "HEATING", Heat: 22, Ts: minutesAgo(24*60 + 10)},
+		Sample{Ambient: 20, HvacState: "HEATING", Heat: 22, Ts: minutesAgo(24*60 + 20)},
+	)
+
+	tm.processDevices(context.Background(), []Device{d}, "token")
+
+	if alerts := tm.notifier.ofType(AlertHeatingFalling); len(alerts) != 0 {
+		t.Errorf("sent %d %s alerts from stale samples, want none", len(alerts), AlertHeatingFalling)
+	}
+}
+
+func TestProcessDevicesHonoursDeviceFilter(t *testing.T) {
+	d1 := testDevice(t, "dev1", 21, "OFF", 20)
+	d2 := testDevice(t, "dev2", 21, "OFF", 20)
+	tm := newTestMonitor(t, testConfig(t, nil), &MockThermostatClient{Devices: []Device{d1, d2}}, WithDeviceFilter("dev2"))
+
+	tm.processDevices(context.Background(), []Device{d1, d2}, "token")
+
+	if n := len(tm.storedSamples(t, "dev1")); n != 0 {
+		t.Errorf("stored %d samples for the filtered-out device, want 0", n)
+	}
+	if n := len(tm.storedSamples(t, "dev2")); n != 1 {
+		t.Errorf("stored %d samples for the selected device, want 1", n)
+	}
+}
+
+// TestDeviceEventChecks runs devices the way Pub/Sub and push events reach
+// processDevice, from merged event traits rather than a poll.
+func TestDeviceEventChecks(t *testing.T) {
+	cfg := testConfig(t, map[string]any{"alert_on_new_device": true})
+	tm := newTestMonitor(t, cfg, nil, WithDeviceFilter("dev2"))
+	ctx := context.Background()
+
+	for _, id := range []string{"dev1", "dev2"} {
+		fixture := testDevice(t, id, 21, "OFF", 20)
+		d, err := tm.traits.apply(fixture.Name, fixture.Traits)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tm.processDevice(ctx, d, "token"); err != nil {
+			t.Fatalf("processDevice(%s): %v", id, err)
+		}
+	}
+
+	if n := len(tm.storedSamples(t, "dev1")); n != 0 {
+		t.Errorf("stored %d samples for the filtered-out device, want 0", n)
+	}
+	if n := len(tm.storedSamples(t, "dev2")); n != 1 {
+		t.Errorf("stored %d samples for the selected device, want 1", n)
+	}
+	alerts := tm.notifier.ofType(AlertNewDevice)
+	if len(alerts) != 1 || alerts[0].DeviceID != "dev2" {
+		t.Errorf("new_device alerts = %+v, want one for dev2", alerts)
+	}
+}
+
+// dropReplyHook applies the first transaction it sees and then fails it
+// with a dropped connection, as if the reply never arrived.
+type dropReplyHook struct {
+	dropped atomic.Bool
+}
+
+func (h *dropReplyHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *dropReplyHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (h *dropReplyHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := next(ctx, cmds); err != nil || cmds[0].Name() != "multi" || !h.dropped.CompareAndSwap(false, true) {
+			return err
+		}
+		return io.ErrUnexpectedEOF
+	}
+}
+
+func TestStoreSampleRetryIsIdempotent(t *testing.T) {
+	d := testDevice(t, "dev1", 21, "HEATING", 22)
+	tm := newTestMonitor(t, testConfig(t, nil), &MockThermostatClient{Devices: []Device{d}})
+	hook := &dropReplyHook{}
+	tm.rdb.AddHook(hook)
+	sample := d.sample()
+	sample.FanTimerMode = "ON"
+	ctx := context.Background()
+
+	if err := tm.handleDeviceSamples(ctx, "dev1", sample, "token"); err != nil {
+		t.Fatalf("handleDeviceSamples: %v", err)
+	}
+	if !hook.dropped.Load() {
+		t.Fatal("the sample wasn't stored in a transaction")
+	}
+	if n := len(tm.storedSamples(t, "dev1")); n != 1 {
+		t.Errorf("stored %d samples after a retried write, want 1", n)
+	}
+	runtime, _ := tm.rdb.Get(ctx, fanRuntimeKey("dev1", sample.Ts.In(tm.config().Location()))).Int()
+	if want := tm.config().PollIntervalMinutes * 60; runtime != want {
+		t.Errorf("fan runtime %ds after a retried write, want %ds", runtime, want)
+	}
+}
+
+// roundTripHook counts the round trips a Redis client makes. With split set
+// it sends each pipelined or transaction command on its own, as
+// handleDeviceSamples did before it pipelined them.
+type roundTripHook struct {
+	rdb   *redis.Client
+	split bool
+	trips atomic.Int64
+}
+
+func (h *roundTripHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *roundTripHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		h.trips.Add(1)
+		return next(ctx, cmd)
+	}
+}
+
+func (h *roundTripHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		// Connection setup is pipelined too, and splitting it would need a
+		// connection to set one up.
+		if !h.split || cmds[0].Name() == "hello" || cmds[0].Name() == "client" {
+			h.trips.Add(1)
+			return next(ctx, cmds)
+		}
+		if cmds[0].Name() == "multi" {
+			cmds = cmds[1 : len(cmds)-1]
+		}
+		for _, cmd := range cmds {
+			// Process counts the trip.
+			h.rdb.Process(ctx, cmd)
+		}
+		return nil
+	}
+}
+
+// BenchmarkHandleDeviceSamples stores a heating sample against miniredis
+// with the sample's writes and window read in one transaction, as they are,
+// and with each command sent on its own. It reports Redis round trips per sample.
+func BenchmarkHandleDeviceSamples(b *testing.B) {
+	for _, split := range []bool{false, true} {
+		name := "pipelined"
+		if split {
+			name = "unpipelined"
+		}
+		b.Run(name, func(b *testing.B) {
+			tm := newTestMonitor(b, testConfig(b, nil), nil)
+			hook := &roundTripHook{rdb: tm.rdb.Client, split: split}
+			tm.rdb.AddHook(hook)
+			d := testDevice(b, "dev1", 21, "HEATING", 22)
+			ctx := context.Background()
+
+			// The first sample opens the connection.
+			if err := tm.handleDeviceSamples(ctx, "dev1", d.sample(), "token"); err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			hook.trips.Store(0)
+			for i := 0; i < b.N; i++ {
+				if err := tm.handleDeviceSamples(ctx, "dev1", d.sample(), "token"); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(hook.trips.Load())/float64(b.N), "roundtrips/op")
+		})
+	}
+}
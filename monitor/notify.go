@@ -0,0 +1,303 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// alertRetryWait is how long Alert waits before retrying a notifier.
+const alertRetryWait = 5 * time.Second
+
+const (
+	// failedAlertsKey lists alerts no notifier retry could deliver.
+	failedAlertsKey = "nest:failed_alerts"
+	failedAlertsLen = 20
+)
+
+// AlertEvent is what gets delivered to each Notifier.
+type AlertEvent struct {
+	Type     string `json:"type"`
+	DeviceID string `json:"device_id"`
+	// DisplayName is the device's custom name, alias or ID, whichever is
+	// set first.
+	DisplayName string    `json:"display_name,omitempty"`
+	Message     string    `json:"message"`
+	Priority    string    `json:"priority"`
+	Time        time.Time `json:"time"`
+	// Ambient is the latest ambient reading, for alerts about a device's
+	// temperature.
+	Ambient *float64 `json:"ambient,omitempty"`
+	// Occupied is the home's occupancy when the device reports it.
+	Occupied *bool `json:"occupied,omitempty"`
+	// Title is the notification title, from Config.AlertTitle.
+	Title string `json:"title,omitempty"`
+	// RetrySeconds and ExpireSeconds are Pushover's retry and expire for
+	// emergency alerts, from Config.AlertRetry and Config.AlertExpire.
+	RetrySeconds  int `json:"retry_seconds,omitempty"`
+	ExpireSeconds int `json:"expire_seconds,omitempty"`
+	// Simulated marks alerts raised by SimulateAnomaly.
+	Simulated bool `json:"simulated,omitempty"`
+	// Queued marks alerts resent from nest:alert_queue after a delay.
+	Queued bool `json:"queued,omitempty"`
+}
+
+// title is the notification title for the event.
+func (e AlertEvent) title() string {
+	t := e.Title
+	if t == "" {
+		t = defaultAppTitle
+	}
+	if e.Simulated {
+		t = "[SIMULATION] " + t
+	}
+	if e.Queued {
+		t = "[QUEUED] " + t
+	}
+	return t
+}
+
+// device is how notifications name the event's device.
+func (e AlertEvent) device() string {
+	if e.DisplayName != "" {
+		return e.DisplayName
+	}
+	return e.DeviceID
+}
+
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, event AlertEvent) error
+}
+
+type PushoverNotifier struct {
+	User   string
+	Token  string
+	Client *http.Client
+	// Redis, if set, counts messages sent each month. Once MonthlyQuota is
+	// reached, further alerts are sent silently, with priority -2.
+	Redis        *redis.Client
+	MonthlyQuota int
+}
+
+// pushoverCountKey counts the Pushover messages sent in t's month, in UTC.
+func pushoverCountKey(t time.Time) string {
+	return fmt.Sprintf("nest:pushover:monthly_count:%s", t.UTC().Format("2006-01"))
+}
+
+// pushoverCountTTL keeps a month's count until well after the month is over.
+const pushoverCountTTL = 35 * 24 * time.Hour
+
+// PushoverMonthlyCount returns how many Pushover messages have been sent this
+// month.
+func PushoverMonthlyCount(ctx context.Context, rdb *redis.Client) (int, error) {
+	n, err := rdb.Get(ctx, pushoverCountKey(time.Now())).Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return n, err
+}
+
+func (p *PushoverNotifier) Name() string {
+	return "pushover"
+}
+
+func (p *PushoverNotifier) Notify(ctx context.Context, event AlertEvent) error {
+	message := fmt.Sprintf("%s: %s", event.device(), event.Message)
+	if p.Redis != nil && p.MonthlyQuota > 0 {
+		if n, err := PushoverMonthlyCount(ctx, p.Redis); err == nil && n >= p.MonthlyQuota {
+			event.Priority = "-2"
+			message = fmt.Sprintf("[Pushover quota: %d of %d messages sent this month] %s", n, p.MonthlyQuota, message)
+		}
+	}
+	data := url.Values{}
+	data.Set("token", p.Token)
+	data.Set("user", p.User)
+	data.Set("title", event.title())
+	data.Set("message", message)
+	data.Set("priority", event.Priority)
+	retry, expire := event.RetrySeconds, event.ExpireSeconds
+	if retry == 0 {
+		retry = defaultAlertRetrySeconds
+	}
+	if expire == 0 {
+		expire = defaultAlertExpireSeconds
+	}
+	data.Set("retry", strconv.Itoa(retry))
+	data.Set("expire", strconv.Itoa(expire))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.pushover.net/1/messages.json", strings.NewReader(data.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("pushover returned status %d", resp.StatusCode)
+	}
+	if p.Redis != nil {
+		key := pushoverCountKey(time.Now())
+		p.Redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Incr(ctx, key)
+			pipe.Expire(ctx, key, pushoverCountTTL)
+			return nil
+		})
+	}
+	return nil
+}
+
+// Alert sends event to every configured notifier, or to its device group's
+// notifiers if the group has any, filling in the priority
+// configured for its type and the current time if they are unset. Each
+// notifier is retried alert_max_retries times; alerts that still fail are
+// logged, kept in nest:failed_alerts and returned as an error. Most callers
+// ignore it, so a broken notifier can't interrupt a poll cycle.
+func (m *Monitor) Alert(ctx context.Context, event AlertEvent) error {
+	if event.Priority == "" {
+		cfg := m.config()
+		event.Priority = cfg.AlertPriority(event.Type)
+		if cfg.SuppressAlertsWhenUnoccupied && event.Occupied != nil && !*event.Occupied {
+			event.Priority = unoccupiedPriority(event.Type, event.Priority)
+		}
+	}
+	if event.Title == "" {
+		event.Title = m.config().AlertTitle(event.Type)
+	}
+	if event.RetrySeconds == 0 {
+		event.RetrySeconds = m.config().AlertRetry(event.Type)
+	}
+	if event.ExpireSeconds == 0 {
+		event.ExpireSeconds = m.config().AlertExpire(event.Type)
+	}
+	if event.DeviceID == SimulatedDeviceID {
+		event.Simulated = true
+	}
+	if event.DisplayName == "" && event.DeviceID != "N/A" {
+		event.DisplayName = m.displayName(event.DeviceID)
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if m.dryRun {
+		m.logger.Info("dry run: skipping alert", "type", event.Type, "device_id", event.DeviceID, "priority", event.Priority, "message", event.Message)
+		return nil
+	}
+	m.recordAlert(ctx, event)
+	if err := m.scheduleEscalation(ctx, event); err != nil {
+		m.logger.Error("failed to schedule escalation", "type", event.Type, "device_id", event.DeviceID, "err", err)
+	}
+	var errs []error
+	for _, n := range m.notifiersFor(event) {
+		if err := m.notify(ctx, n, event); err != nil {
+			m.logger.Error("failed to send alert", "notifier", n.Name(), "type", event.Type, "device_id", event.DeviceID, "err", err)
+			m.recordFailedAlert(ctx, n.Name(), event, err)
+			if n.Name() == "pushover" {
+				m.queueAlert(ctx, event, err)
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", n.Name(), err))
+			continue
+		}
+		m.logger.Info("alert sent", "notifier", n.Name(), "type", event.Type, "device_id", event.DeviceID, "priority", event.Priority, "message", event.Message)
+		if n.Name() == "pushover" {
+			m.flushAlertQueue(ctx)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// notifiersFor returns the notifiers event goes to: its device group's, if
+// the group has any, else every configured notifier.
+func (m *Monitor) notifiersFor(event AlertEvent) []Notifier {
+	if g := m.config().groupOf(event.DeviceID); g != nil && len(g.Notifiers) > 0 {
+		var rdb *redis.Client
+		if m.rdb != nil {
+			rdb = m.rdb.Client
+		}
+		return groupNotifiers(g, m.config(), m.httpClient, rdb)
+	}
+	return m.notifiers
+}
+
+func (m *Monitor) alert(ctx context.Context, alertType, deviceID, msg string) error {
+	return m.Alert(ctx, AlertEvent{Type: alertType, DeviceID: deviceID, Message: msg})
+}
+
+// notify delivers event through n, retrying up to alert_max_retries times,
+// alertRetryWait apart.
+func (m *Monitor) notify(ctx context.Context, n Notifier, event AlertEvent) error {
+	retries := m.config().AlertMaxRetries
+	err := n.Notify(ctx, event)
+	for attempt := 1; err != nil && attempt <= retries; attempt++ {
+		m.logger.Warn("alert delivery failed, retrying", "notifier", n.Name(), "type", event.Type, "attempt", attempt, "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(alertRetryWait):
+		}
+		err = n.Notify(ctx, event)
+	}
+	return err
+}
+
+// recordFailedAlert keeps an alert that couldn't be delivered in
+// nest:failed_alerts, for a later look.
+func (m *Monitor) recordFailedAlert(ctx context.Context, notifier string, event AlertEvent, deliveryErr error) {
+	if m.rdb == nil {
+		return
+	}
+	data, _ := json.Marshal(map[string]any{"notifier": notifier, "error": deliveryErr.Error(), "event": event})
+	_, err := m.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.LPush(ctx, failedAlertsKey, data)
+		p.LTrim(ctx, failedAlertsKey, 0, failedAlertsLen-1)
+		return nil
+	})
+	if err != nil {
+		m.logger.Warn("failed to record undelivered alert", "notifier", notifier, "type", event.Type, "err", err)
+	}
+}
+
+// escalationNotifiers are the notifiers only used by escalation_chain steps.
+func escalationNotifiers(cfg *Config, client *http.Client) []Notifier {
+	var notifiers []Notifier
+	if cfg.SMTPHost != "" {
+		notifiers = append(notifiers, &EmailNotifier{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.EmailFrom,
+			To:       cfg.EmailTo,
+		})
+	}
+	if cfg.PagerDutyRoutingKey != "" {
+		notifiers = append(notifiers, &PagerDutyNotifier{RoutingKey: cfg.PagerDutyRoutingKey, Client: client})
+	}
+	return notifiers
+}
+
+func configuredNotifiers(cfg *Config, client *http.Client, rdb *redis.Client) []Notifier {
+	var notifiers []Notifier
+	if cfg.PushoverToken != "" {
+		notifiers = append(notifiers, &PushoverNotifier{User: cfg.PushoverUser, Token: cfg.PushoverToken, Client: client, Redis: rdb, MonthlyQuota: cfg.PushoverMonthlyQuotaLimit})
+	}
+	if cfg.DiscordWebhookURL != "" {
+		notifiers = append(notifiers, &DiscordNotifier{WebhookURL: cfg.DiscordWebhookURL, Client: client})
+	}
+	if cfg.PublishAlertsToRedis && rdb != nil {
+		notifiers = append(notifiers, &RedisNotifier{Client: rdb, Channel: cfg.RedisPubSubChannel})
+	}
+	return notifiers
+}
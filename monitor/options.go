@@ -0,0 +1,157 @@
+package monitor
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// configPathEnv names the environment variable NewMonitor reads the config
+// path from when no config is given.
+const configPathEnv = "NEST_MONITOR_CONFIG"
+
+// Option configures a Monitor built by NewMonitor.
+type Option func(*options)
+
+type options struct {
+	cfg        *Config
+	rdb        *redis.Client
+	rdbSet     bool
+	httpClient *http.Client
+	notifiers  []Notifier
+	audit      AuditLogger
+	logger     *slog.Logger
+	client     ThermostatClient
+	dryRun     bool
+	profile    bool
+	device     string
+	// debugSamples receives the -debug-samples table.
+	debugSamples io.Writer
+}
+
+// WithConfig sets the config. Without it, the config is loaded from the file
+// named by $NEST_MONITOR_CONFIG, or config.json.
+func WithConfig(cfg *Config) Option {
+	return func(o *options) { o.cfg = cfg }
+}
+
+// WithRedisClient sets the Redis client. Without it, a client for the
+// config's redis_addr is created. Passing nil leaves the Monitor without
+// Redis, which is enough for ListDevices.
+func WithRedisClient(rdb *redis.Client) Option {
+	return func(o *options) { o.rdb, o.rdbSet = rdb, true }
+}
+
+// WithHTTPClient sets the HTTP client used for OAuth, the SDM API and
+// notifiers.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) { o.httpClient = client }
+}
+
+// WithNotifiers replaces the notifiers configured in the config.
+func WithNotifiers(notifiers ...Notifier) Option {
+	return func(o *options) { o.notifiers = notifiers }
+}
+
+// WithAuditLogger replaces the audit log configured in the config. It is
+// only written to with audit_enabled set.
+func WithAuditLogger(audit AuditLogger) Option {
+	return func(o *options) { o.audit = audit }
+}
+
+// WithLogger sets the logger. It defaults to slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) { o.logger = logger }
+}
+
+// WithThermostatClient replaces the SDM API client, e.g. with a fake.
+func WithThermostatClient(client ThermostatClient) Option {
+	return func(o *options) { o.client = client }
+}
+
+// WithDryRun makes the Monitor log the alerts it would send, the SDM
+// commands it would execute and the Redis writes it would make instead of
+// doing any of them. The hook that drops writes is added to the Redis client.
+func WithDryRun() Option {
+	return func(o *options) { o.dryRun = true }
+}
+
+// WithProfiling serves the net/http/pprof endpoints under /debug/pprof/ on
+// Handler, behind the X-Admin-Token header.
+func WithProfiling() Option {
+	return func(o *options) { o.profile = true }
+}
+
+// WithDeviceFilter limits processing to one device, given as its full
+// resource name or its short ID.
+func WithDeviceFilter(device string) Option {
+	return func(o *options) { o.device = device }
+}
+
+// WithSampleTable prints a table of every device's latest sample to w after
+// each poll, marking devices whose trend would raise an alert.
+func WithSampleTable(w io.Writer) Option {
+	return func(o *options) { o.debugSamples = w }
+}
+
+// NewMonitor returns a Monitor wired up from opts, falling back to defaults
+// for anything not given.
+func NewMonitor(opts ...Option) (*Monitor, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.cfg == nil {
+		path := os.Getenv(configPathEnv)
+		if path == "" {
+			path = "config.json"
+		}
+		cfg, err := LoadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		o.cfg = cfg
+	}
+	if !o.rdbSet {
+		o.rdb = o.cfg.RedisClient()
+	}
+	if o.logger == nil {
+		o.logger = slog.Default()
+	}
+	if o.httpClient == nil {
+		o.httpClient = newHTTPClient(o.cfg, o.logger)
+	}
+	if o.client == nil {
+		o.client = &SDMClient{
+			ProjectID:     o.cfg.ProjectID,
+			HTTPClient:    o.httpClient,
+			Logger:        o.logger,
+			Redis:         o.rdb,
+			MaxRetryAfter: time.Duration(o.cfg.MaxRetryAfterSeconds) * time.Second,
+		}
+	}
+	if o.notifiers == nil {
+		o.notifiers = configuredNotifiers(o.cfg, o.httpClient, o.rdb)
+	}
+	if o.audit == nil {
+		audit, err := configuredAuditLogger(o.cfg, o.rdb)
+		if err != nil {
+			return nil, err
+		}
+		o.audit = audit
+	} else if !o.cfg.AuditEnabled {
+		o.audit = nil
+	}
+	if o.dryRun {
+		o.client = dryRunClient{ThermostatClient: o.client, logger: o.logger}
+		if o.rdb != nil {
+			o.rdb.AddHook(dryRunHook{logger: o.logger})
+		}
+	}
+	return newMonitor(o), nil
+}
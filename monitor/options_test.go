@@ -0,0 +1,66 @@
+package monitor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewMonitorWithThermostatClientAndRedis(t *testing.T) {
+	d := testDevice(t, "dev1", 21, "OFF", 20)
+	tm := newTestMonitor(t, testConfig(t, nil), &MockThermostatClient{Devices: []Device{d}})
+	ctx := context.Background()
+
+	devices, err := tm.fetchDevicesCached(ctx, "token")
+	if err != nil {
+		t.Fatalf("fetchDevicesCached: %v", err)
+	}
+	if len(devices) != 1 || tm.client.Fetches != 1 {
+		t.Fatalf("got %d devices from %d fetches, want 1 from the mock", len(devices), tm.client.Fetches)
+	}
+	if !tm.redis.Exists(deviceCacheKey) {
+		t.Errorf("device list wasn't cached in the given Redis")
+	}
+}
+
+func TestNewMonitorDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"project_id": "from-env", "redis_addr": "redis.example:6380"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(configPathEnv, path)
+
+	m, err := NewMonitor()
+	if err != nil {
+		t.Fatalf("NewMonitor: %v", err)
+	}
+	t.Cleanup(func() { m.rdb.Close() })
+	if got := m.config().ProjectID; got != "from-env" {
+		t.Errorf("project_id = %q, want the one from $%s", got, configPathEnv)
+	}
+	if got := m.rdb.Options().Addr; got != "redis.example:6380" {
+		t.Errorf("Redis addr = %q, want redis_addr", got)
+	}
+	sdm, ok := m.client.(*SDMClient)
+	if !ok || sdm.ProjectID != "from-env" {
+		t.Errorf("client = %#v, want an SDMClient for the project", m.client)
+	}
+}
+
+func TestNewMonitorMissingConfig(t *testing.T) {
+	t.Setenv(configPathEnv, filepath.Join(t.TempDir(), "missing.json"))
+	if _, err := NewMonitor(); err == nil {
+		t.Error("NewMonitor succeeded without a config file")
+	}
+}
+
+func TestWithRedisClientNil(t *testing.T) {
+	m, err := NewMonitor(WithConfig(testConfig(t, nil)), WithRedisClient(nil), WithThermostatClient(&MockThermostatClient{}))
+	if err != nil {
+		t.Fatalf("NewMonitor: %v", err)
+	}
+	if m.rdb != nil {
+		t.Errorf("Monitor has Redis after WithRedisClient(nil)")
+	}
+}
@@ -0,0 +1,79 @@
+package monitor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// readConfigObject reads a config file as a generic JSON object, for
+// merging.
+func readConfigObject(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// loadConfigWithOverlay loads the config at basePath with the one at
+// overlayPath merged on top. Non-zero overlay values replace the base's,
+// objects are merged key by key, and lists such as device_groups are
+// appended to the base's.
+func loadConfigWithOverlay(basePath, overlayPath string) (*Config, error) {
+	base, err := readConfigObject(basePath)
+	if err != nil {
+		return nil, err
+	}
+	overlay, err := readConfigObject(overlayPath)
+	if err != nil {
+		return nil, err
+	}
+	return decodeConfig(mergeConfigObjects(base, overlay))
+}
+
+func mergeConfigObjects(base, overlay map[string]any) map[string]any {
+	for k, v := range overlay {
+		switch v := v.(type) {
+		case nil:
+			continue
+		case string:
+			if v == "" {
+				continue
+			}
+		case float64:
+			if v == 0 {
+				continue
+			}
+		case bool:
+			if !v {
+				continue
+			}
+		case map[string]any:
+			if b, ok := base[k].(map[string]any); ok {
+				base[k] = mergeConfigObjects(b, v)
+				continue
+			}
+		case []any:
+			if b, ok := base[k].([]any); ok {
+				base[k] = append(b, v...)
+				continue
+			}
+		}
+		base[k] = v
+	}
+	return base
+}
+
+// overlayPath resolves config_overlay relative to the directory of the
+// config file that names it.
+func overlayPath(configPath, overlay string) string {
+	if filepath.IsAbs(overlay) {
+		return overlay
+	}
+	return filepath.Join(filepath.Dir(configPath), overlay)
+}
@@ -0,0 +1,61 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutyNotifier triggers incidents through the PagerDuty Events API v2.
+type PagerDutyNotifier struct {
+	RoutingKey string
+	Client     *http.Client
+}
+
+func (p *PagerDutyNotifier) Name() string {
+	return "pagerduty"
+}
+
+func (p *PagerDutyNotifier) Notify(ctx context.Context, event AlertEvent) error {
+	severity := "warning"
+	if event.Priority == "2" {
+		severity = "critical"
+	}
+	body, err := json.Marshal(map[string]any{
+		"routing_key":  p.RoutingKey,
+		"event_action": "trigger",
+		// One incident per device and alert type, however many times it
+		// escalates.
+		"dedup_key": event.DeviceID + ":" + event.Type,
+		"payload": map[string]any{
+			"summary":   fmt.Sprintf("%s: %s", event.device(), event.Message),
+			"source":    event.DeviceID,
+			"severity":  severity,
+			"timestamp": event.Time.Format(time.RFC3339),
+			"class":     event.Type,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", pagerDutyEventsURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("pagerduty returned status %d", resp.StatusCode)
+	}
+	return nil
+}
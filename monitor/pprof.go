@@ -0,0 +1,25 @@
+package monitor
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// ProfileHandler serves the net/http/pprof endpoints under /debug/pprof/.
+// Profiles expose memory contents and cost CPU to take, so every request
+// needs an X-Admin-Token header matching admin_token.
+func (m *Monitor) ProfileHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.adminAuthorized(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,207 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// pubSubPullTimeout bounds a pull request. Pulls are long-polls, so a quiet
+// subscription can hold one open for about this long, but a dead connection
+// doesn't hold it forever.
+const pubSubPullTimeout = 2 * time.Minute
+
+// pubSubRetryWait is how long RunPubSub waits after a failed pull before
+// pulling again.
+const pubSubRetryWait = 10 * time.Second
+
+type pubSubMessage struct {
+	AckID   string `json:"ackId"`
+	Message struct {
+		Data      string `json:"data"`
+		MessageID string `json:"messageId"`
+	} `json:"message"`
+}
+
+// sdmEvent is the payload of an SDM Pub/Sub message. Only trait updates
+// carry data we care about; relation and session events are ignored.
+type sdmEvent struct {
+	EventID        string `json:"eventId"`
+	Timestamp      string `json:"timestamp"`
+	ResourceUpdate *struct {
+		Name   string                     `json:"name"`
+		Traits map[string]json.RawMessage `json:"traits"`
+	} `json:"resourceUpdate"`
+}
+
+// pullMessages pulls up to 20 messages. It goes through the monitor's HTTP
+// client, for request IDs and log_http_requests, bounded by
+// pubSubPullTimeout.
+func (m *Monitor) pullMessages(ctx context.Context, cfg *Config, token string) ([]pubSubMessage, error) {
+	body, _ := json.Marshal(map[string]int{"maxMessages": 20})
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("https://pubsub.googleapis.com/v1/%s:pull", cfg.PubSubSubscription), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := *m.httpClient
+	client.Timeout = pubSubPullTimeout
+	resp, err := doRequest(&client, m.logger, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("pull returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		ReceivedMessages []pubSubMessage `json:"receivedMessages"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result.ReceivedMessages, nil
+}
+
+func (m *Monitor) ackMessages(ctx context.Context, cfg *Config, token string, ackIDs []string) error {
+	body, _ := json.Marshal(map[string][]string{"ackIds": ackIDs})
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("https://pubsub.googleapis.com/v1/%s:acknowledge", cfg.PubSubSubscription), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := doRequest(m.httpClient, m.logger, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("acknowledge returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func parseEvent(msg pubSubMessage) (*sdmEvent, error) {
+	data, err := base64.StdEncoding.DecodeString(msg.Message.Data)
+	if err != nil {
+		return nil, err
+	}
+	var event sdmEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// RunPubSub handles device events as they are published instead of polling.
+// Events only carry the traits that changed, so the last known traits of
+// every device are kept in memory and a full refresh runs periodically. It
+// returns when ctx is cancelled or the first refresh fails. Later failures,
+// which getDevices and the token manager have already alerted on, keep the
+// last known traits and are retried; the health checker reports a refresh
+// that stays stale.
+func (m *Monitor) RunPubSub(ctx context.Context) error {
+	refresh := func() error {
+		token, err := m.tokens.Get(ctx)
+		if err != nil {
+			return err
+		}
+		devices, err := m.getDevices(ctx, token)
+		if err != nil {
+			return err
+		}
+		// The fetch replaces the token if the API rejected it.
+		if token, err = m.tokens.Get(ctx); err != nil {
+			return err
+		}
+		m.processDevices(ctx, devices, token)
+		return nil
+	}
+
+	if err := refresh(); err != nil {
+		return err
+	}
+	lastRefresh := time.Now()
+
+	for ; ctx.Err() == nil; m.watchdog.pollCompleted() {
+		cfg := m.config()
+		refreshInterval := time.Duration(cfg.PubSubRefreshMinutes) * time.Minute
+		token, err := m.tokens.Get(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			m.logger.Error("failed to get access token, retrying", "err", err, "wait", pubSubRetryWait)
+			select {
+			case <-ctx.Done():
+			case <-time.After(pubSubRetryWait):
+			}
+			continue
+		}
+		if time.Since(lastRefresh) > refreshInterval {
+			if err := refresh(); err != nil && ctx.Err() == nil {
+				m.logger.Error("device refresh failed, retrying next interval", "err", err, "interval", refreshInterval)
+			}
+			lastRefresh = time.Now()
+		}
+
+		// The pull can take up to pubSubPullTimeout, so it gets the whole
+		// watchdog timeout rather than sharing it with a refresh.
+		m.watchdog.pollCompleted()
+		msgs, err := m.pullMessages(ctx, cfg, token)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			m.logger.Error("pubsub pull failed", "subscription", cfg.PubSubSubscription, "err", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(pubSubRetryWait):
+			}
+			continue
+		}
+		if len(msgs) == 0 {
+			continue
+		}
+
+		var ackIDs []string
+		for _, msg := range msgs {
+			ackIDs = append(ackIDs, msg.AckID)
+
+			event, err := parseEvent(msg)
+			if err != nil {
+				m.logger.Warn("dropping malformed pubsub message", "message_id", msg.Message.MessageID, "err", err)
+				continue
+			}
+			if event.ResourceUpdate == nil || len(event.ResourceUpdate.Traits) == 0 {
+				continue
+			}
+
+			d, err := m.traits.apply(event.ResourceUpdate.Name, event.ResourceUpdate.Traits)
+			if err != nil {
+				m.logger.Warn("failed to parse device event", "event_id", event.EventID, "err", err)
+				continue
+			}
+			m.logger.Debug("device event", "device_id", d.ID, "event_id", event.EventID)
+			if err := m.processDevice(ctx, d, token); err != nil {
+				m.logger.Error("failed to process device event", "device_id", d.ID, "event_id", event.EventID, "err", err)
+			}
+		}
+
+		if err := m.ackMessages(ctx, cfg, token, ackIDs); err != nil {
+			m.logger.Error("pubsub acknowledge failed", "subscription", cfg.PubSubSubscription, "err", err)
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,155 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRunPubSubStopsDuringRetryWait(t *testing.T) {
+	d := testDevice(t, "dev1", 21, "OFF", 20)
+	cfg := testConfig(t, map[string]any{"pubsub_subscription": "projects/p/subscriptions/s"})
+	pulled := make(chan struct{}, 1)
+	httpClient := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		select {
+		case pulled <- struct{}{}:
+		default:
+		}
+		return nil, errors.New("connection refused")
+	})}
+	tm := newTestMonitor(t, cfg, &MockThermostatClient{Devices: []Device{d}}, WithHTTPClient(httpClient))
+	tm.tokens.token, tm.tokens.expiresAt = "token", time.Now().Add(time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- tm.RunPubSub(ctx) }()
+
+	<-pulled
+	start := time.Now()
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("RunPubSub = %v, want context.Canceled", err)
+		}
+		if waited := time.Since(start); waited > pubSubRetryWait/2 {
+			t.Errorf("RunPubSub took %v to stop, want it to skip the retry wait", waited)
+		}
+	case <-time.After(pubSubRetryWait + 5*time.Second):
+		t.Fatal("RunPubSub didn't return after cancellation")
+	}
+}
+
+func TestRunPubSubKicksWatchdogBeforePull(t *testing.T) {
+	d := testDevice(t, "dev1", 21, "OFF", 20)
+	cfg := testConfig(t, map[string]any{"pubsub_subscription": "projects/p/subscriptions/s"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sinceKick := make(chan time.Duration, 1)
+	var tm *testMonitor
+	httpClient := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		select {
+		case sinceKick <- time.Since(tm.watchdog.lastPollCompletedAt.Load().(time.Time)):
+		default:
+		}
+		cancel()
+		return nil, context.Canceled
+	})}
+	tm = newTestMonitor(t, cfg, &MockThermostatClient{Devices: []Device{d}}, WithHTTPClient(httpClient))
+	tm.tokens.token, tm.tokens.expiresAt = "token", time.Now().Add(time.Hour)
+	// As if the refresh before the pull had taken a long time.
+	tm.watchdog.lastPollCompletedAt.Store(time.Now().Add(-time.Hour))
+
+	tm.RunPubSub(ctx)
+	if since := <-sinceKick; since > time.Minute {
+		t.Errorf("pull started %v after the last watchdog kick, want it kicked first", since)
+	}
+}
+
+func TestPullMessagesUsesMonitorClient(t *testing.T) {
+	cfg := testConfig(t, map[string]any{"pubsub_subscription": "projects/p/subscriptions/s"})
+	var got *http.Request
+	httpClient := jsonResponse(http.StatusOK, `{"receivedMessages": [{"ackId": "a1", "message": {"data": "e30=", "messageId": "m1"}}]}`)
+	next := httpClient.Transport
+	httpClient.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		got = r
+		return next.RoundTrip(r)
+	})
+	tm := newTestMonitor(t, cfg, nil, WithHTTPClient(httpClient))
+
+	msgs, err := tm.pullMessages(context.Background(), cfg, "token")
+	if err != nil {
+		t.Fatalf("pullMessages: %v", err)
+	}
+	if len(msgs) != 1 || msgs[0].AckID != "a1" {
+		t.Errorf("pullMessages = %+v, want the one message", msgs)
+	}
+	if got == nil || got.Header.Get(requestIDHeader) == "" {
+		t.Errorf("pull request wasn't sent through the monitor's client with a request ID")
+	}
+	if httpClient.Timeout != 0 {
+		t.Errorf("the pull timeout leaked into the monitor's client")
+	}
+}
+
+func TestRunPubSubKeepsRunningWhenTokenFails(t *testing.T) {
+	d := testDevice(t, "dev1", 21, "OFF", 20)
+	cfg := testConfig(t, map[string]any{"pubsub_subscription": "projects/p/subscriptions/s", "max_token_refresh_retries": 1})
+	tokenFailed := make(chan struct{}, 1)
+	var tm *testMonitor
+	httpClient := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if r.URL.Host == "oauth2.googleapis.com" {
+			select {
+			case tokenFailed <- struct{}{}:
+			default:
+			}
+			return nil, errors.New("connection refused")
+		}
+		// The token is revoked while the first pull is open.
+		tm.tokens.Invalidate()
+		return jsonResponse(http.StatusOK, `{}`).Transport.RoundTrip(r)
+	})}
+	tm = newTestMonitor(t, cfg, &MockThermostatClient{Devices: []Device{d}}, WithHTTPClient(httpClient))
+	tm.tokens.token, tm.tokens.expiresAt = "token", time.Now().Add(time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- tm.RunPubSub(ctx) }()
+
+	<-tokenFailed
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("RunPubSub = %v, want it to keep running until cancelled", err)
+	}
+	if alerts := tm.notifier.ofType(AlertTokenError); len(alerts) != 1 {
+		t.Errorf("sent %d %s alerts, want 1", len(alerts), AlertTokenError)
+	}
+}
+
+func TestRunPushKicksWatchdogBetweenRefreshes(t *testing.T) {
+	old := pushIdleWait
+	pushIdleWait = time.Millisecond
+	t.Cleanup(func() { pushIdleWait = old })
+	d := testDevice(t, "dev1", 21, "OFF", 20)
+	tm := newTestMonitor(t, testConfig(t, nil), &MockThermostatClient{Devices: []Device{d}})
+	tm.tokens.token, tm.tokens.expiresAt = "token", time.Now().Add(time.Hour)
+	stale := time.Now().Add(-time.Hour)
+	tm.watchdog.lastPollCompletedAt.Store(stale)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- tm.RunPush(ctx) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for tm.watchdog.lastPollCompletedAt.Load().(time.Time).Equal(stale) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("RunPush = %v, want context.Canceled", err)
+	}
+	if tm.watchdog.lastPollCompletedAt.Load().(time.Time).Equal(stale) {
+		t.Error("RunPush never kicked the watchdog while waiting for the next refresh")
+	}
+}
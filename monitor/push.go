@@ -0,0 +1,182 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// deviceTraits keeps the last known traits of every device. SDM events only
+// carry the traits that changed, so they're merged into these before the
+// device is parsed.
+type deviceTraits struct {
+	mu     sync.Mutex
+	byName map[string]map[string]json.RawMessage
+}
+
+func newDeviceTraits() *deviceTraits {
+	return &deviceTraits{byName: make(map[string]map[string]json.RawMessage)}
+}
+
+// seed replaces the known traits of devices with freshly fetched ones.
+func (t *deviceTraits) seed(devices []Device) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range devices {
+		t.byName[devices[i].Name] = devices[i].traitMap()
+	}
+}
+
+// device returns the device parsed from its last known traits, or nil if it
+// hasn't been seen.
+func (t *deviceTraits) device(name string) *Device {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	traits, ok := t.byName[name]
+	if !ok {
+		return nil
+	}
+	d, err := UnmarshalDevice(traits)
+	if err != nil {
+		return nil
+	}
+	return d
+}
+
+// apply merges an event's updated traits into the device's known traits and
+// returns the parsed result.
+func (t *deviceTraits) apply(name string, update map[string]json.RawMessage) (*Device, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	traits, ok := t.byName[name]
+	if !ok {
+		traits = map[string]json.RawMessage{
+			"deviceName": json.RawMessage(fmt.Sprintf(`"%s"`, name)),
+		}
+		t.byName[name] = traits
+	}
+	for k, v := range update {
+		traits[k] = v
+	}
+	return UnmarshalDevice(traits)
+}
+
+// pushRequest is the body of a Pub/Sub push delivery.
+type pushRequest struct {
+	Message struct {
+		Data      string `json:"data"`
+		MessageID string `json:"messageId"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// servePushEvent handles POST /events/sdm, a Pub/Sub push delivery of an SDM
+// event. Any non-2xx response makes Pub/Sub redeliver the message.
+func (m *Monitor) servePushEvent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	cfg := m.config()
+
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		http.Error(w, "missing bearer token", http.StatusUnauthorized)
+		return
+	}
+	if err := verifyGoogleJWT(ctx, &m.certs, m.httpClient, raw, cfg.PubSubPushAudience, cfg.PubSubPushServiceAccount); err != nil {
+		m.logger.Warn("rejected pubsub push", "err", err)
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	var push pushRequest
+	if err := json.NewDecoder(r.Body).Decode(&push); err != nil {
+		http.Error(w, "malformed push request", http.StatusBadRequest)
+		return
+	}
+	var msg pubSubMessage
+	msg.Message.Data = push.Message.Data
+	msg.Message.MessageID = push.Message.MessageID
+	event, err := parseEvent(msg)
+	if err != nil {
+		m.logger.Warn("malformed pubsub push message", "message_id", push.Message.MessageID, "err", err)
+		http.Error(w, "malformed event", http.StatusBadRequest)
+		return
+	}
+	if event.ResourceUpdate == nil || len(event.ResourceUpdate.Traits) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	d, err := m.traits.apply(event.ResourceUpdate.Name, event.ResourceUpdate.Traits)
+	if err != nil {
+		m.logger.Warn("failed to parse device event", "event_id", event.EventID, "err", err)
+		http.Error(w, "malformed event", http.StatusBadRequest)
+		return
+	}
+	m.logger.Debug("device event", "device_id", d.ID, "event_id", event.EventID)
+	token, err := m.tokens.Get(ctx)
+	if err != nil {
+		http.Error(w, "no access token", http.StatusServiceUnavailable)
+		return
+	}
+	if err := m.processDevice(ctx, d, token); err != nil {
+		m.logger.Error("failed to process device event", "device_id", d.ID, "event_id", event.EventID, "err", err)
+		http.Error(w, "failed to process event", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pushIdleWait is how often RunPush, between refreshes, checks whether the
+// next one is due. Each check kicks the watchdog, so only a hung refresh
+// trips it. Tests shorten it.
+var pushIdleWait = 10 * time.Second
+
+// RunPush seeds the known device traits and then refreshes every device
+// every PubSubRefreshMinutes, while events arrive through the
+// POST /events/sdm handler. Only the first refresh is fatal; a later failed
+// refresh is logged, alerted by getDevices or the token manager, and retried
+// on the next interval. It returns when ctx is cancelled.
+func (m *Monitor) RunPush(ctx context.Context) error {
+	refresh := func() error {
+		token, err := m.tokens.Get(ctx)
+		if err != nil {
+			return err
+		}
+		devices, err := m.getDevices(ctx, token)
+		if err != nil {
+			return err
+		}
+		m.processDevices(ctx, devices, token)
+		return nil
+	}
+
+	if err := refresh(); err != nil {
+		return err
+	}
+	lastRefresh := time.Now()
+
+	for ; ctx.Err() == nil; m.watchdog.pollCompleted() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pushIdleWait):
+		}
+		refreshInterval := time.Duration(m.config().PubSubRefreshMinutes) * time.Minute
+		if time.Since(lastRefresh) < refreshInterval {
+			continue
+		}
+		if err := refresh(); err != nil && ctx.Err() == nil {
+			m.logger.Error("device refresh failed, retrying next interval", "err", err, "interval", refreshInterval)
+		}
+		lastRefresh = time.Now()
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,46 @@
+package monitor
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// maxRateLimitRetries is how many times a request is retried after a 429.
+const maxRateLimitRetries = 3
+
+// doWithRateLimit sends req like doRequest, but on a 429 waits for the
+// Retry-After duration, or an exponential backoff without one, and tries
+// again, up to maxRateLimitRetries times. Waits are capped at maxWait if it
+// is positive. The last response is returned as is, 429 or not.
+func doWithRateLimit(client *http.Client, logger *slog.Logger, req *http.Request, maxWait time.Duration) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := doRequest(client, logger, req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests || attempt == maxRateLimitRetries {
+			return resp, err
+		}
+		resp.Body.Close()
+
+		wait := time.Second << attempt
+		if h := resp.Header.Get("Retry-After"); h != "" {
+			wait = retryAfter(h)
+		}
+		if maxWait > 0 {
+			wait = min(wait, maxWait)
+		}
+		logger.Warn("rate limited, retrying", "url", redactURL(req.URL), "attempt", attempt+1, "wait", wait)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package monitor
+
+import "github.com/redis/go-redis/v9"
+
+// Redis deployments, selected by Config.RedisMode.
+const (
+	redisModeStandalone = "standalone"
+	redisModeSentinel   = "sentinel"
+)
+
+// RedisClient returns a client for the configured Redis. In sentinel mode it
+// is a failover client, which finds the master through the sentinels and
+// follows it when they promote a replica.
+func (c *Config) RedisClient() *redis.Client {
+	if c.RedisMode == redisModeSentinel {
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       c.SentinelMasterName,
+			SentinelAddrs:    c.SentinelAddrs,
+			SentinelPassword: c.SentinelPassword,
+			Password:         c.RedisPassword,
+		})
+	}
+	return redis.NewClient(&redis.Options{Addr: c.RedisAddr, Password: c.RedisPassword})
+}
@@ -0,0 +1,131 @@
+package monitor
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+// fakeSentinel runs a miniredis that answers SENTINEL commands for one
+// master, which is as much of Sentinel as a failover client needs to find
+// it.
+func fakeSentinel(t *testing.T, masterName, masterAddr, password string) *miniredis.Miniredis {
+	t.Helper()
+	s := miniredis.RunT(t)
+	if password != "" {
+		s.RequireAuth(password)
+	}
+	host, port, err := net.SplitHostPort(masterAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Server().Register("SENTINEL", func(c *server.Peer, cmd string, args []string) {
+		if len(args) == 0 {
+			c.WriteError("ERR wrong number of arguments for 'sentinel' command")
+			return
+		}
+		switch strings.ToLower(args[0]) {
+		case "get-master-addr-by-name":
+			if len(args) != 2 || args[1] != masterName {
+				c.WriteNull()
+				return
+			}
+			c.WriteStrings([]string{host, port})
+		case "sentinels", "replicas", "slaves":
+			c.WriteLen(0)
+		default:
+			c.WriteError("ERR unknown sentinel subcommand '" + args[0] + "'")
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRedisClientSentinel(t *testing.T) {
+	master := miniredis.RunT(t)
+	master.RequireAuth("master-secret")
+	sentinel := fakeSentinel(t, "mymaster", master.Addr(), "sentinel-secret")
+
+	cfg := testConfig(t, map[string]any{
+		"redis_mode":           "sentinel",
+		"sentinel_master_name": "mymaster",
+		"sentinel_addrs":       []string{sentinel.Addr()},
+		"sentinel_password":    "sentinel-secret",
+		"redis_password":       "master-secret",
+		// Ignored in sentinel mode.
+		"redis_addr": "127.0.0.1:1",
+	})
+	for _, err := range cfg.ValidationErrors() {
+		if strings.Contains(err.Error(), "redis") || strings.Contains(err.Error(), "sentinel") {
+			t.Fatalf("ValidationErrors: %v", err)
+		}
+	}
+	rdb := cfg.RedisClient()
+	defer rdb.Close()
+
+	if err := rdb.Set(context.Background(), "k", "v", 0).Err(); err != nil {
+		t.Fatalf("SET through the sentinel's master: %v", err)
+	}
+	if got, _ := master.Get("k"); got != "v" {
+		t.Errorf("master has k = %q, want the write to reach it", got)
+	}
+}
+
+func TestRedisClientSentinelWrongMaster(t *testing.T) {
+	master := miniredis.RunT(t)
+	sentinel := fakeSentinel(t, "mymaster", master.Addr(), "")
+
+	cfg := testConfig(t, map[string]any{
+		"redis_mode":           "sentinel",
+		"sentinel_master_name": "other",
+		"sentinel_addrs":       []string{sentinel.Addr()},
+	})
+	rdb := cfg.RedisClient()
+	defer rdb.Close()
+
+	if err := rdb.Ping(context.Background()).Err(); err == nil {
+		t.Error("PING succeeded for a master the sentinel doesn't know")
+	}
+}
+
+func TestRedisClientStandalonePassword(t *testing.T) {
+	s := miniredis.RunT(t)
+	s.RequireAuth("secret")
+
+	cfg := testConfig(t, map[string]any{"redis_addr": s.Addr(), "redis_password": "secret"})
+	rdb := cfg.RedisClient()
+	defer rdb.Close()
+
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Errorf("PING with redis_password: %v", err)
+	}
+}
+
+func TestRedisModeValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]any
+		want   string
+	}{
+		{"unknown mode", map[string]any{"redis_mode": "cluster"}, "redis_mode must be standalone or sentinel"},
+		{"sentinel without master", map[string]any{"redis_mode": "sentinel", "sentinel_addrs": []string{"s:26379"}}, "sentinel_master_name"},
+		{"sentinel without addrs", map[string]any{"redis_mode": "sentinel", "sentinel_master_name": "mymaster"}, "sentinel_addrs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var found bool
+			for _, err := range testConfig(t, tt.fields).ValidationErrors() {
+				found = found || strings.Contains(err.Error(), tt.want)
+			}
+			if !found {
+				t.Errorf("no validation error mentioning %q", tt.want)
+			}
+		})
+	}
+}
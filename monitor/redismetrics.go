@@ -0,0 +1,64 @@
+package monitor
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisTimingHook records how long each Redis command, or pipeline, takes in
+// nest_redis_operation_duration_seconds.
+type redisTimingHook struct {
+	mt *metrics
+}
+
+func (h redisTimingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h redisTimingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.mt.redisDuration.WithLabelValues(cmd.Name(), keyDeviceID(cmd)).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+func (h redisTimingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		var deviceID string
+		for _, cmd := range cmds {
+			if deviceID = keyDeviceID(cmd); deviceID != "" {
+				break
+			}
+		}
+		h.mt.redisDuration.WithLabelValues("pipeline", deviceID).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// keyDeviceID returns the device ID in a command's nest:{deviceID}:... key,
+// or "" for commands on keys that aren't a device's.
+func keyDeviceID(cmd redis.Cmder) string {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return ""
+	}
+	key, ok := args[1].(string)
+	if !ok || strings.HasPrefix(key, deviceCacheKey) {
+		return ""
+	}
+	parts := strings.Split(key, ":")
+	if len(parts) < 3 || parts[0] != "nest" {
+		return ""
+	}
+	return parts[1]
+}
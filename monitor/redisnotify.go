@@ -0,0 +1,28 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisNotifier publishes alerts as JSON to a Redis pub/sub channel, for
+// home automation systems that subscribe to it. Publishing is
+// fire-and-forget: a failed publish is reported once and never retried.
+type RedisNotifier struct {
+	Client  *redis.Client
+	Channel string
+}
+
+func (r *RedisNotifier) Name() string {
+	return "redis"
+}
+
+func (r *RedisNotifier) Notify(ctx context.Context, event AlertEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return r.Client.Publish(ctx, r.Channel, data).Err()
+}
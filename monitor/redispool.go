@@ -0,0 +1,79 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisPool wraps a Redis client so operations can ride out a dropped
+// connection instead of failing on the first error.
+type RedisPool struct {
+	*redis.Client
+
+	// Timeout is how long withRetry keeps trying to reconnect before giving
+	// up on an operation.
+	Timeout time.Duration
+	Logger  *slog.Logger
+	// OnDown is called once when Redis has been unreachable for longer than
+	// Timeout, and again only after it has come back and gone away again.
+	OnDown func(ctx context.Context, err error)
+
+	down atomic.Bool
+}
+
+// isConnError reports whether err means Redis couldn't be reached, as
+// opposed to a command failing.
+func isConnError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// withRetry runs fn, and if it fails because Redis is unreachable, waits for
+// Redis to answer a ping again and runs fn once more. It gives up after
+// Timeout and returns the last error.
+func (p *RedisPool) withRetry(ctx context.Context, fn func() error) error {
+	err := fn()
+	if err == nil || !isConnError(err) {
+		p.markUp()
+		return err
+	}
+
+	deadline := time.Now().Add(p.Timeout)
+	wait := 500 * time.Millisecond
+	for time.Now().Before(deadline) {
+		p.Logger.Warn("redis unreachable, retrying", "err", err, "wait", wait)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, 5*time.Second)
+
+		if pingErr := p.Ping(ctx).Err(); pingErr != nil {
+			err = pingErr
+			continue
+		}
+		if err = fn(); err == nil || !isConnError(err) {
+			p.markUp()
+			return err
+		}
+	}
+
+	if p.down.CompareAndSwap(false, true) && p.OnDown != nil {
+		p.OnDown(ctx, err)
+	}
+	return err
+}
+
+func (p *RedisPool) markUp() {
+	if p.down.CompareAndSwap(true, false) {
+		p.Logger.Info("redis reachable again")
+	}
+}
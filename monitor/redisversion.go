@@ -0,0 +1,61 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// minRedisVersion is the oldest Redis the monitor works with. HSET with
+// several fields at once, used for device state hashes, needs 4.0.
+const minRedisVersion = "4.0.0"
+
+// checkRedisVersion reads redis_version from INFO server and returns an
+// error if it is older than minVersion.
+func checkRedisVersion(ctx context.Context, rdb *redis.Client, minVersion string) error {
+	info, err := rdb.Info(ctx, "server").Result()
+	if err != nil {
+		return fmt.Errorf("reading redis version: %w", err)
+	}
+	var version string
+	sc := bufio.NewScanner(strings.NewReader(info))
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(sc.Text()), "redis_version:"); ok {
+			version = v
+			break
+		}
+	}
+	if version == "" {
+		return fmt.Errorf("redis INFO server has no redis_version")
+	}
+	if compareVersions(version, minVersion) < 0 {
+		return fmt.Errorf("redis %s is too old: the monitor needs %s or newer", version, minVersion)
+	}
+	return nil
+}
+
+// compareVersions compares dotted version strings numerically, treating
+// missing or non-numeric parts as 0.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
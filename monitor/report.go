@@ -0,0 +1,240 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/robfig/cron/v3"
+)
+
+// reportPeriod is how far back a report looks. Data older than
+// retention_days is already gone, so a shorter retention shortens it too.
+const reportPeriod = 7 * 24 * time.Hour
+
+// MonitorReport summarizes every device's week.
+type MonitorReport struct {
+	GeneratedAt time.Time      `json:"generated_at"`
+	Since       time.Time      `json:"since"`
+	Devices     []DeviceReport `json:"devices"`
+}
+
+// DeviceReport is one device's part of a MonitorReport.
+type DeviceReport struct {
+	DeviceID string `json:"device_id"`
+	Alias    string `json:"alias,omitempty"`
+	// AverageAmbient is the mean of the recorded ambient readings, in the
+	// unit they were recorded in.
+	AverageAmbient     float64        `json:"average_ambient"`
+	Samples            int            `json:"samples"`
+	HVACRuntimeMinutes float64        `json:"hvac_runtime_minutes"`
+	FanRuntimeMinutes  float64        `json:"fan_runtime_minutes"`
+	Alerts             map[string]int `json:"alerts"`
+}
+
+// Report computes a MonitorReport from the time series and alert history in
+// Redis. Devices are those with stored samples, as in Status.
+func (m *Monitor) Report(ctx context.Context) (*MonitorReport, error) {
+	cfg := m.config()
+	now := cfg.now()
+	report := &MonitorReport{GeneratedAt: now, Since: now.Add(-reportPeriod), Devices: []DeviceReport{}}
+
+	iter := m.rdb.Scan(ctx, 0, samplesKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		deviceID := strings.TrimSuffix(strings.TrimPrefix(iter.Val(), "nest:"), ":temps")
+		dr, err := m.deviceReport(ctx, cfg, deviceID, report.Since)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", deviceID, err)
+		}
+		report.Devices = append(report.Devices, dr)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(report.Devices, func(i, j int) bool { return report.Devices[i].DeviceID < report.Devices[j].DeviceID })
+	return report, nil
+}
+
+func (m *Monitor) deviceReport(ctx context.Context, cfg *Config, deviceID string, since time.Time) (DeviceReport, error) {
+	dr := DeviceReport{DeviceID: deviceID, Alias: cfg.DeviceAliases[deviceID], Alerts: map[string]int{}}
+
+	ambient, err := m.readTimeSeries(ctx, deviceID, "ambient", since.Unix())
+	if err != nil {
+		return dr, err
+	}
+	for _, p := range ambient {
+		dr.AverageAmbient += p.value
+	}
+	if len(ambient) > 0 {
+		dr.AverageAmbient /= float64(len(ambient))
+	}
+	dr.Samples = len(ambient)
+
+	hvac, err := m.readTimeSeries(ctx, deviceID, "hvac", since.Unix())
+	if err != nil {
+		return dr, err
+	}
+	dr.HVACRuntimeMinutes = hvacRuntime(hvac, cfg.maxSampleGap()).Minutes()
+
+	fan, err := m.fanRuntimeSince(ctx, deviceID, since, cfg.now())
+	if err != nil {
+		return dr, err
+	}
+	dr.FanRuntimeMinutes = fan.Minutes()
+
+	alerts, err := m.ListAlertHistory(deviceID, 0)
+	if err != nil {
+		return dr, err
+	}
+	for _, a := range alerts {
+		if !a.Time.Before(since) {
+			dr.Alerts[a.Type]++
+		}
+	}
+	return dr, nil
+}
+
+// hvacRuntime adds up the time between each active reading and the next one.
+// Gaps longer than maxGap, e.g. while the monitor was down, count as maxGap.
+func hvacRuntime(points []chartPoint, maxGap time.Duration) time.Duration {
+	var total time.Duration
+	for i := 0; i+1 < len(points); i++ {
+		if points[i].value == 0 {
+			continue
+		}
+		gap := time.Duration(points[i+1].ts-points[i].ts) * time.Second
+		total += min(gap, maxGap)
+	}
+	return total
+}
+
+// formatReport renders the report as JSON or as a plain-text table.
+func formatReport(r *MonitorReport, format string) ([]byte, error) {
+	if format == "json" {
+		return json.MarshalIndent(r, "", "  ")
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Nest thermostat report, %s to %s\n\n", r.Since.Format("2006-01-02"), r.GeneratedAt.Format("2006-01-02"))
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DEVICE ID\tALIAS\tAVG AMBIENT\tSAMPLES\tHVAC RUNTIME\tFAN RUNTIME\tALERTS")
+	for _, d := range r.Devices {
+		fmt.Fprintf(w, "%s\t%s\t%.1f\t%d\t%s\t%s\t%s\n", d.DeviceID, d.Alias, d.AverageAmbient, d.Samples,
+			time.Duration(d.HVACRuntimeMinutes*float64(time.Minute)).Round(time.Minute),
+			time.Duration(d.FanRuntimeMinutes*float64(time.Minute)).Round(time.Minute), alertCounts(d.Alerts))
+	}
+	w.Flush()
+	return b.Bytes(), nil
+}
+
+// alertCounts renders alert counts as "type=n" pairs in type order.
+func alertCounts(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "-"
+	}
+	types := make([]string, 0, len(counts))
+	for t := range counts {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	parts := make([]string, len(types))
+	for i, t := range types {
+		parts[i] = fmt.Sprintf("%s=%d", t, counts[t])
+	}
+	return strings.Join(parts, " ")
+}
+
+// WriteReport computes a report and writes it to report_output_path and/or
+// s3_bucket, in report_format.
+func (m *Monitor) WriteReport(ctx context.Context) error {
+	cfg := m.config()
+	if cfg.ReportOutputPath == "" && cfg.S3Bucket == "" {
+		return fmt.Errorf("report_output_path or s3_bucket must be set")
+	}
+	report, err := m.Report(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := formatReport(report, cfg.ReportFormat)
+	if err != nil {
+		return err
+	}
+
+	if cfg.ReportOutputPath != "" {
+		if err := os.WriteFile(cfg.ReportOutputPath, data, 0o644); err != nil {
+			return err
+		}
+		m.logger.Info("report written", "path", cfg.ReportOutputPath, "devices", len(report.Devices))
+	}
+	if cfg.S3Bucket != "" {
+		key := cfg.reportS3Key(report.GeneratedAt)
+		if err := uploadReport(ctx, cfg.S3Bucket, key, data, cfg.ReportFormat); err != nil {
+			return fmt.Errorf("uploading report to s3://%s/%s: %w", cfg.S3Bucket, key, err)
+		}
+		m.logger.Info("report uploaded", "bucket", cfg.S3Bucket, "key", key, "devices", len(report.Devices))
+	}
+	return nil
+}
+
+// reportS3Key is s3_key, or a dated key when it isn't set.
+func (c *Config) reportS3Key(t time.Time) string {
+	if c.S3Key != "" {
+		return c.S3Key
+	}
+	ext := "txt"
+	if c.ReportFormat == "json" {
+		ext = "json"
+	}
+	return fmt.Sprintf("nest-monitor/report-%s.%s", t.Format("2006-01-02"), ext)
+}
+
+// uploadReport puts the report in S3. Credentials, region and, for other
+// S3-compatible stores, the endpoint come from the usual AWS environment
+// variables and shared config files.
+func uploadReport(ctx context.Context, bucket, key string, data []byte, format string) error {
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return err
+	}
+	contentType := "text/plain; charset=utf-8"
+	if format == "json" {
+		contentType = "application/json"
+	}
+	_, err = s3.NewFromConfig(awsCfg).PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	return err
+}
+
+// ScheduleReports starts writing reports on report_schedule. The caller
+// stops the returned scheduler; it is nil when no schedule is configured.
+func (m *Monitor) ScheduleReports() (*cron.Cron, error) {
+	spec := m.config().ReportSchedule
+	if spec == "" {
+		return nil, nil
+	}
+	c := cron.New()
+	_, err := c.AddFunc(spec, func() {
+		if err := m.WriteReport(context.Background()); err != nil {
+			m.logger.Error("scheduled report failed", "err", err)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.Start()
+	m.logger.Info("reports scheduled", "schedule", spec)
+	return c, nil
+}
@@ -0,0 +1,74 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReprocessedAlert is an alert that replaying a device's stored samples
+// would raise.
+type ReprocessedAlert struct {
+	DeviceID string    `json:"device_id"`
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Message  string    `json:"message"`
+}
+
+// ReprocessSamples replays each device's stored samples, or only the device
+// given to WithDeviceFilter, oldest first, through the sudden-drop and trend
+// checks with the current config. It returns the alerts they would raise, in
+// time order. Nothing is written and nothing is sent, so thresholds can be
+// tuned against real readings.
+func (m *Monitor) ReprocessSamples(ctx context.Context) ([]ReprocessedAlert, error) {
+	var alerts []ReprocessedAlert
+	iter := m.rdb.Scan(ctx, 0, samplesKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		deviceID := strings.TrimSuffix(strings.TrimPrefix(iter.Val(), "nest:"), ":temps")
+		if m.device != "" && m.device != deviceID && m.device != m.deviceName(deviceID) {
+			continue
+		}
+		raw, err := m.rdb.LRange(ctx, iter.Val(), 0, -1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", deviceID, err)
+		}
+		alerts = append(alerts, m.replaySamples(deviceID, decodeSamples(raw))...)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(alerts, func(i, j int) bool { return alerts[i].Time.Before(alerts[j].Time) })
+	return alerts, nil
+}
+
+// replaySamples feeds samples, newest first as stored, to the checks one at
+// a time from the oldest, as if each had just been polled. As in
+// checkAnomaly, a trend only alerts when it starts.
+func (m *Monitor) replaySamples(deviceID string, samples []Sample) []ReprocessedAlert {
+	cfg := m.config()
+	unit := m.sampleUnit(deviceID)
+	maxAge := time.Duration(cfg.MaxSampleAgeMinutes) * time.Minute
+	var alerts []ReprocessedAlert
+	active := ""
+	for i := len(samples) - 1; i >= 0; i-- {
+		newest := samples[i]
+		window := freshSamples(samples[i:], newest.Ts, maxAge)
+		if len(window) > cfg.SampleWindow {
+			window = window[:cfg.SampleWindow]
+		}
+		if msg := detectSuddenDrop(window, unit, cfg); msg != "" {
+			alerts = append(alerts, ReprocessedAlert{DeviceID: deviceID, Type: AlertSuddenDrop, Time: newest.Ts, Message: msg})
+		}
+		if len(window) < cfg.SampleWindow || staleGap(window, cfg.maxSampleGap()) > 0 {
+			continue
+		}
+		anomaly := detectTrend(window, unit, cfg)
+		if anomaly != "" && anomaly != active {
+			alerts = append(alerts, ReprocessedAlert{DeviceID: deviceID, Type: anomaly, Time: newest.Ts, Message: trendMessage(anomaly, window)})
+		}
+		active = anomaly
+	}
+	return alerts
+}
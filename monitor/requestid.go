@@ -0,0 +1,45 @@
+package monitor
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	requestIDHeader     = "X-Request-ID"
+	deviceRequestIDsLen = 10
+)
+
+// newRequestID returns a random (version 4) UUID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// doRequest sends req tagged with a fresh X-Request-ID and logs the exchange
+// at debug level, including any request ID Google returned, so failures can
+// be correlated with the API side. A client with log_http_requests set logs
+// the exchange itself, so it isn't logged twice.
+func doRequest(client *http.Client, logger *slog.Logger, req *http.Request) (*http.Response, error) {
+	requestID := newRequestID()
+	req.Header.Set(requestIDHeader, requestID)
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if logsRequests(client) {
+		return resp, err
+	}
+	attrs := []any{"method", req.Method, "url", redactURL(req.URL), "latency", time.Since(start)}
+	if err != nil {
+		logger.Debug("http request failed", append(attrs, "request_id", requestID, "err", err)...)
+		return nil, err
+	}
+	logger.Debug("http request", append(attrs, responseAttrs(req, resp)...)...)
+	return resp, nil
+}
@@ -0,0 +1,98 @@
+package monitor
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+)
+
+// rotateKeep is how many entries of each list RotateLogs leaves in Redis.
+const rotateKeep = 10
+
+// RotateLogs appends every device's alert history and event log to the file
+// at path as JSON lines, each with device_id and log ("alerts" or "events")
+// added, then trims the lists in Redis to their newest 10 entries. With
+// compress, the lines are written as a gzip member, which gzip tools read as
+// part of the same file. Lists are only trimmed once the archive has been
+// written and closed. It returns how many entries were archived per device.
+func (m *Monitor) RotateLogs(ctx context.Context, path string, compress bool) (map[string]int, error) {
+	var keys []string
+	for _, pattern := range []string{alertsKey("*"), deviceEventsKey("*")} {
+		iter := m.rdb.Scan(ctx, 0, pattern, 100).Iterator()
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+		}
+		if err := iter.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	var w io.Writer = f
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(f)
+		w = zw
+	}
+	bw := bufio.NewWriter(w)
+
+	counts := map[string]int{}
+	err = func() error {
+		for _, key := range keys {
+			deviceID, log := splitLogKey(key)
+			entries, err := m.rdb.LRange(ctx, key, 0, -1).Result()
+			if err != nil {
+				return err
+			}
+			// Lists are newest first; archive oldest first.
+			for i := len(entries) - 1; i >= 0; i-- {
+				var entry map[string]any
+				if err := json.Unmarshal([]byte(entries[i]), &entry); err != nil {
+					m.logger.Warn("skipping malformed log entry", "key", key, "err", err)
+					continue
+				}
+				entry["device_id"] = deviceID
+				entry["log"] = log
+				line, _ := json.Marshal(entry)
+				bw.Write(line)
+				bw.WriteByte('\n')
+				counts[deviceID]++
+			}
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		if zw != nil {
+			return zw.Close()
+		}
+		return nil
+	}()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return counts, err
+	}
+
+	for _, key := range keys {
+		if err := m.rdb.LTrim(ctx, key, 0, rotateKeep-1).Err(); err != nil {
+			return counts, err
+		}
+	}
+	return counts, nil
+}
+
+// splitLogKey returns the device ID and list name ("alerts" or "events")
+// of a nest:{deviceID}:{list} key.
+func splitLogKey(key string) (deviceID, log string) {
+	rest := strings.TrimPrefix(key, "nest:")
+	i := strings.LastIndex(rest, ":")
+	return rest[:i], rest[i+1:]
+}
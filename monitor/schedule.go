@@ -0,0 +1,155 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const weekSeconds = 7 * 24 * 60 * 60
+
+// ThermostatSchedule is the programmed setpoint schedule from the
+// ThermostatSchedule trait.
+type ThermostatSchedule struct {
+	HeatScheduleType string          `json:"heatScheduleType"`
+	Events           []ScheduleEvent `json:"events"`
+}
+
+// ScheduleEvent is a setpoint change the schedule makes on the days in
+// DayMask (bit 0 is Sunday) at TimeOffsetSeconds past local midnight.
+// Setpoints are in Celsius; zero means the event doesn't set one.
+type ScheduleEvent struct {
+	DayMask           int     `json:"dayMask"`
+	TimeOffsetSeconds int     `json:"timeOffsetSeconds"`
+	HeatCelsius       float64 `json:"heatCelsius,omitempty"`
+	CoolCelsius       float64 `json:"coolCelsius,omitempty"`
+}
+
+// activeEvent returns the event in effect at t: the one that most recently
+// fired, wrapping around to the previous week. It is nil for an empty
+// schedule.
+func (s *ThermostatSchedule) activeEvent(t time.Time) *ScheduleEvent {
+	now := int(t.Weekday())*86400 + t.Hour()*3600 + t.Minute()*60 + t.Second()
+	var active *ScheduleEvent
+	best := weekSeconds
+	for i := range s.Events {
+		e := &s.Events[i]
+		for day := 0; day < 7; day++ {
+			if e.DayMask&(1<<day) == 0 {
+				continue
+			}
+			ago := ((now-(day*86400+e.TimeOffsetSeconds))%weekSeconds + weekSeconds) % weekSeconds
+			if ago < best {
+				active, best = e, ago
+			}
+		}
+	}
+	return active
+}
+
+// resolveActiveSetpoint returns the setpoint a HEATCOOL thermostat is working
+// towards: heat while heating, cool while cooling, and ambient, i.e. no
+// deviation expected, while off. A thermostat that is IDLE should be inside
+// the heat-cool range, so ambient outside it resolves to the bound it has
+// crossed.
+func resolveActiveSetpoint(hvacState string, heat, cool, ambient float64) float64 {
+	switch hvacState {
+	case "HEATING":
+		return heat
+	case "COOLING":
+		return cool
+	case "IDLE":
+		if ambient < heat {
+			return heat
+		}
+		if ambient > cool {
+			return cool
+		}
+	}
+	return ambient
+}
+
+// scheduleDeviationKey marks a deviation from the schedule that has already
+// been alerted on.
+func scheduleDeviationKey(deviceID string) string {
+	return fmt.Sprintf("nest:%s:schedule_deviation", deviceID)
+}
+
+// checkScheduleDeviation alerts when ambient is more than
+// setpoint_deviation_threshold °F below the scheduled heat setpoint or above the
+// scheduled cool setpoint. With both set, only the one resolveActiveSetpoint
+// picks is checked. The schedule comes from the device's last known
+// traits, so devices not yet fetched by this process are skipped.
+func (m *Monitor) checkScheduleDeviation(ctx context.Context, deviceID string, sample Sample) error {
+	cfg := m.config().forDevice(deviceID)
+	if !cfg.AlertOnScheduleDeviation {
+		return nil
+	}
+	d := m.traits.device(m.deviceName(deviceID))
+	if d == nil || d.Schedule == nil || d.Mode == "OFF" {
+		return nil
+	}
+	e := d.Schedule.activeEvent(sample.Ts)
+	if e == nil {
+		return nil
+	}
+
+	heat, cool := e.HeatCelsius, e.CoolCelsius
+	threshold := cfg.SetpointDeviationThreshold * 5 / 9
+	hysteresis := cfg.AlertHysteresisF * 5 / 9
+	if m.sampleUnit(deviceID) == "FAHRENHEIT" {
+		threshold = cfg.SetpointDeviationThreshold
+		hysteresis = cfg.AlertHysteresisF
+		if heat != 0 {
+			heat = cToF(heat)
+		}
+		if cool != 0 {
+			cool = cToF(cool)
+		}
+	}
+
+	if heat != 0 && cool != 0 {
+		// In HEATCOOL both setpoints are active; only check the one the
+		// HVAC is working towards.
+		switch resolveActiveSetpoint(sample.HvacState, heat, cool, sample.Ambient) {
+		case heat:
+			cool = 0
+		case cool:
+			heat = 0
+		default:
+			heat, cool = 0, 0
+		}
+	}
+
+	var expected, off float64
+	switch {
+	case heat != 0 && heat-sample.Ambient > threshold:
+		expected, off = heat, heat-sample.Ambient
+	case cool != 0 && sample.Ambient-cool > threshold:
+		expected, off = cool, sample.Ambient-cool
+	case heat != 0 && heat-sample.Ambient > threshold-hysteresis,
+		cool != 0 && sample.Ambient-cool > threshold-hysteresis:
+		// Within alert_hysteresis_f of the threshold: an active deviation
+		// stays active, so a reading hovering at the threshold doesn't alert
+		// again every other poll.
+		return nil
+	default:
+		return m.rdb.Del(ctx, scheduleDeviationKey(deviceID)).Err()
+	}
+
+	// SetNX only succeeds for a new deviation.
+	isNew, err := m.rdb.SetNX(ctx, scheduleDeviationKey(deviceID), expected, 0).Result()
+	if err != nil || !isNew {
+		return err
+	}
+	m.logger.Warn("ambient off schedule", "device_id", deviceID, "ambient", sample.Ambient, "scheduled", expected)
+	ambient := sample.Ambient
+	m.Alert(ctx, AlertEvent{
+		Type:     AlertScheduleDeviation,
+		DeviceID: deviceID,
+		Message:  fmt.Sprintf("Ambient %.1f is %.1f off the scheduled setpoint of %.1f", sample.Ambient, off, expected),
+		Ambient:  &ambient,
+		Occupied: sample.Occupied,
+	})
+	return nil
+}
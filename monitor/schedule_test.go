@@ -0,0 +1,43 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestScheduleDeviationThresholdIsFahrenheit(t *testing.T) {
+	tm := newTestMonitor(t, testConfig(t, map[string]any{"alert_on_schedule_deviation": true}), nil)
+	ctx := context.Background()
+
+	// Scheduled to heat to 21°C all week, on a Celsius device.
+	d := testDevice(t, "dev1", 21, "HEATING", 21)
+	schedule, err := json.Marshal(ThermostatSchedule{Events: []ScheduleEvent{{DayMask: 0x7f, HeatCelsius: 21}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Traits["sdm.devices.traits.ThermostatSchedule"] = schedule
+	if _, err := tm.traits.apply(d.Name, d.Traits); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ambient float64
+		alerts  int
+	}{
+		// 1°C is 1.8°F below, within the default 2°F.
+		{20, 0},
+		// 1.2°C is 2.16°F below.
+		{19.8, 1},
+	}
+	for _, tt := range tests {
+		sample := d.sample()
+		sample.Ambient = tt.ambient
+		if err := tm.checkScheduleDeviation(ctx, "dev1", sample); err != nil {
+			t.Fatalf("checkScheduleDeviation: %v", err)
+		}
+		if n := len(tm.notifier.ofType(AlertScheduleDeviation)); n != tt.alerts {
+			t.Errorf("at %v°C sent %d %s alerts, want %d", tt.ambient, n, AlertScheduleDeviation, tt.alerts)
+		}
+	}
+}
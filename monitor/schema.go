@@ -0,0 +1,23 @@
+package monitor
+
+import (
+	"encoding/json"
+
+	"github.com/invopop/jsonschema"
+)
+
+// ConfigSchema returns the JSON Schema for the config file, for editors to
+// validate and complete config.json with. Field descriptions are taken from
+// the doc comments in srcDir, this package's source directory; if it can't
+// be read, the schema is returned without them along with the error.
+func ConfigSchema(srcDir string) ([]byte, error) {
+	r := &jsonschema.Reflector{RequiredFromJSONSchemaTags: true}
+	commentErr := r.AddGoComments("thermostat", srcDir)
+	schema := r.Reflect(&Config{})
+	schema.Title = "Nest thermostat monitor config"
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return data, commentErr
+}
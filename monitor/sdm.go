@@ -0,0 +1,222 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrNoDevices is returned when the SDM API lists no devices for the project.
+// The API occasionally does this transiently, so it's retried before
+// alerting.
+var ErrNoDevices = errors.New("no devices found")
+
+// CheckCredentials fetches an access token once, without retrying, alerting
+// or keeping it, to confirm Google accepts the configured OAuth credentials.
+func (m *Monitor) CheckCredentials(ctx context.Context) error {
+	_, _, err := m.tokens.refresh(ctx)
+	return err
+}
+
+// withTokenRetry calls fn with token. If the API rejects the token, the
+// cached token is invalidated and fn is called once more with a new one.
+func (m *Monitor) withTokenRetry(ctx context.Context, token string, fn func(token string) error) error {
+	err := fn(token)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized {
+		m.logger.Warn("access token rejected, refreshing", "request_id", apiErr.RequestID)
+		m.tokens.Invalidate()
+		if token, err = m.tokens.Get(ctx); err != nil {
+			return err
+		}
+		err = fn(token)
+	}
+	return err
+}
+
+// fetchDevices lists every device, retrying once with a new token if the
+// API rejects token.
+func (m *Monitor) fetchDevices(ctx context.Context, token string) ([]Device, error) {
+	var devices []Device
+	err := m.withTokenRetry(ctx, token, func(token string) (err error) {
+		devices, err = m.client.FetchDevices(ctx, token)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, ErrNoDevices
+	}
+	return devices, nil
+}
+
+// fetchDevice reads one device, retrying once with a new token if the API
+// rejects token.
+func (m *Monitor) fetchDevice(ctx context.Context, token, deviceID string) (Device, error) {
+	var d Device
+	err := m.withTokenRetry(ctx, token, func(token string) (err error) {
+		d, err = m.client.FetchDevice(ctx, token, m.deviceName(deviceID))
+		return err
+	})
+	return d, err
+}
+
+func (m *Monitor) deviceName(deviceID string) string {
+	return fmt.Sprintf("enterprises/%s/devices/%s", m.config().ProjectID, deviceID)
+}
+
+// shutoffKey holds a device's mode and setpoints, in Celsius, from just
+// before it was turned off, so they can be restored on recovery.
+func shutoffKey(deviceID string) string {
+	return fmt.Sprintf("nest:%s:shutoff", deviceID)
+}
+
+// saveShutoffState records the device's current mode and setpoints before it
+// is turned off.
+func (m *Monitor) saveShutoffState(ctx context.Context, deviceID, token string) error {
+	d, err := m.fetchDevice(ctx, token, deviceID)
+	if err != nil {
+		return err
+	}
+	var setpoint struct {
+		Heat float64 `json:"heatCelsius"`
+		Cool float64 `json:"coolCelsius"`
+	}
+	if raw, ok := d.Traits["sdm.devices.traits.ThermostatTemperatureSetpoint"]; ok {
+		if err := json.Unmarshal(raw, &setpoint); err != nil {
+			return err
+		}
+	}
+	return m.rdb.HSet(ctx, shutoffKey(deviceID), "mode", d.Mode, "heat_celsius", setpoint.Heat, "cool_celsius", setpoint.Cool).Err()
+}
+
+func (m *Monitor) turnOffThermostat(ctx context.Context, deviceID, token string) {
+	if deviceID == SimulatedDeviceID {
+		m.logger.Info("thermostat turned off (simulated)", "device_id", deviceID)
+		m.alert(ctx, AlertTurnOffSuccess, deviceID, "Thermostat turned off due to emergency alert")
+		return
+	}
+	err := m.shutOff(ctx, deviceID, token)
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr):
+		if errors.Is(err, errDeviceNotFound) {
+			m.invalidateDeviceCache(ctx)
+		}
+		m.logger.Error("turn-off request rejected", "device_id", deviceID, "status", apiErr.StatusCode, "request_id", apiErr.RequestID)
+		m.alert(ctx, AlertTurnOffFailed, deviceID, fmt.Sprintf("Thermostat turn-off request returned status %d", apiErr.StatusCode))
+	case err != nil:
+		m.logger.Error("turn-off request failed", "device_id", deviceID, "err", err)
+		m.alert(ctx, AlertTurnOffFailed, deviceID, "Failed to turn off thermostat")
+	default:
+		m.logger.Info("thermostat turned off", "device_id", deviceID)
+		m.recordEvent(ctx, deviceID, EventTurnOff, "turned off after an emergency alert")
+		m.alert(ctx, AlertTurnOffSuccess, deviceID, "Thermostat turned off due to emergency alert")
+	}
+}
+
+// shutOff saves the device's mode and setpoints, turns it off and, with
+// auto_restore set, starts its restore window. It doesn't alert.
+func (m *Monitor) shutOff(ctx context.Context, deviceID, token string) error {
+	if err := m.saveShutoffState(ctx, deviceID, token); err != nil {
+		m.logger.Warn("failed to save state before turn-off", "device_id", deviceID, "err", err)
+	}
+	if err := m.setThermostatMode(ctx, deviceID, "OFF", token); err != nil {
+		return err
+	}
+	if m.config().AutoRestore {
+		if err := m.markRestorePending(ctx, deviceID); err != nil {
+			m.logger.Warn("failed to schedule auto-restore", "device_id", deviceID, "err", err)
+		}
+	}
+	return nil
+}
+
+// turnOnThermostat sets the device to mode, which must be HEAT, COOL or
+// HEATCOOL.
+func (m *Monitor) turnOnThermostat(ctx context.Context, deviceID, mode, token string) error {
+	switch mode {
+	case "HEAT", "COOL", "HEATCOOL":
+	default:
+		return fmt.Errorf("cannot turn on thermostat in mode %q", mode)
+	}
+	if err := m.setThermostatMode(ctx, deviceID, mode, token); err != nil {
+		return err
+	}
+	m.recordEvent(ctx, deviceID, EventTurnOn, "turned on in "+mode)
+	return nil
+}
+
+// setThermostatMode switches the device to mode. If the device's available
+// modes are known, a mode it doesn't support is rejected without calling the
+// API.
+func (m *Monitor) setThermostatMode(ctx context.Context, deviceID, mode, token string) error {
+	if d := m.traits.device(m.deviceName(deviceID)); d != nil && len(d.AvailableModes) > 0 && !slices.Contains(d.AvailableModes, mode) {
+		return fmt.Errorf("device %s does not support %s mode (supports: %s)", deviceID, mode, strings.Join(d.AvailableModes, ", "))
+	}
+	err := m.executeCommand(ctx, deviceID, "sdm.devices.commands.ThermostatMode.SetMode", map[string]any{"mode": mode}, token)
+	if err != nil {
+		m.recordEvent(ctx, deviceID, EventSetMode, fmt.Sprintf("SetMode %s failed: %v", mode, err))
+		return err
+	}
+	m.recordEvent(ctx, deviceID, EventSetMode, "SetMode "+mode)
+	return nil
+}
+
+// restoreSetpoints sets the device's heat and cool setpoints, in Celsius. A
+// setpoint of zero is left alone, so it works for every mode.
+func (m *Monitor) restoreSetpoints(ctx context.Context, deviceID string, heat, cool float64, token string) error {
+	const prefix = "sdm.devices.commands.ThermostatTemperatureSetpoint."
+	var command string
+	params := map[string]any{}
+	switch {
+	case heat != 0 && cool != 0:
+		command = prefix + "SetRange"
+		params["heatCelsius"], params["coolCelsius"] = heat, cool
+	case heat != 0:
+		command = prefix + "SetHeat"
+		params["heatCelsius"] = heat
+	case cool != 0:
+		command = prefix + "SetCool"
+		params["coolCelsius"] = cool
+	default:
+		return nil
+	}
+	return m.executeCommand(ctx, deviceID, command, params, token)
+}
+
+// restoreAfterShutoff turns a device that was shut off by the monitor back on
+// in the mode and setpoints it had before. It does nothing for devices that
+// weren't shut off. A failed restore is alerted and returned, and the saved
+// state is kept so it can be tried again.
+func (m *Monitor) restoreAfterShutoff(ctx context.Context, deviceID, token string) error {
+	key := shutoffKey(deviceID)
+	state, err := m.rdb.HGetAll(ctx, key).Result()
+	if err != nil || len(state) == 0 {
+		return err
+	}
+	mode := state["mode"]
+	heat, _ := strconv.ParseFloat(state["heat_celsius"], 64)
+	cool, _ := strconv.ParseFloat(state["cool_celsius"], 64)
+
+	err = m.turnOnThermostat(ctx, deviceID, mode, token)
+	if err == nil {
+		err = m.restoreSetpoints(ctx, deviceID, heat, cool, token)
+	}
+	if err != nil {
+		m.logger.Error("failed to restore thermostat", "device_id", deviceID, "mode", mode, "err", err)
+		m.alert(ctx, AlertTurnOnFailed, deviceID, "Failed to restore thermostat after recovery: "+err.Error())
+		return fmt.Errorf("restoring thermostat: %w", err)
+	}
+
+	m.logger.Info("thermostat restored", "device_id", deviceID, "mode", mode, "heat_celsius", heat, "cool_celsius", cool)
+	m.alert(ctx, AlertTurnOnSuccess, deviceID, fmt.Sprintf("Thermostat restored to %s after recovery", mode))
+	// Restored one way or the other, so the auto_restore window is done.
+	return m.rdb.Del(ctx, key, restorePendingKey(deviceID)).Err()
+}
@@ -0,0 +1,102 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SeasonalModeRule lists the HVAC states expected during a range of months,
+// e.g. COOLING or OFF from June to September. MonthStart and MonthEnd are
+// 1-12 and inclusive; a range may wrap around the new year.
+type SeasonalModeRule struct {
+	Name          string   `json:"name"`
+	MonthStart    int      `json:"month_start"`
+	MonthEnd      int      `json:"month_end"`
+	ExpectedModes []string `json:"expected_modes"`
+	// AlertPriority overrides the seasonal_mode priority for this rule.
+	AlertPriority string `json:"alert_priority"`
+}
+
+// months returns the months the rule covers, or none if they're invalid.
+func (r SeasonalModeRule) months() []time.Month {
+	if r.MonthStart < 1 || r.MonthStart > 12 || r.MonthEnd < 1 || r.MonthEnd > 12 {
+		return nil
+	}
+	var months []time.Month
+	for m := r.MonthStart; ; m = m%12 + 1 {
+		months = append(months, time.Month(m))
+		if m == r.MonthEnd {
+			return months
+		}
+	}
+}
+
+func (r SeasonalModeRule) covers(month time.Month) bool {
+	return slices.Contains(r.months(), month)
+}
+
+// validateSeasonalRules checks each rule's fields and that no month is
+// covered by more than one rule.
+func validateSeasonalRules(rules []SeasonalModeRule) error {
+	owner := map[time.Month]string{}
+	for i, r := range rules {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if r.MonthStart < 1 || r.MonthStart > 12 || r.MonthEnd < 1 || r.MonthEnd > 12 {
+			return fmt.Errorf("seasonal_mode_rules %s: months must be between 1 and 12", name)
+		}
+		if len(r.ExpectedModes) == 0 {
+			return fmt.Errorf("seasonal_mode_rules %s: expected_modes is empty", name)
+		}
+		for _, month := range r.months() {
+			if other, ok := owner[month]; ok {
+				return fmt.Errorf("seasonal_mode_rules %s and %s both cover %s", other, name, month)
+			}
+			owner[month] = name
+		}
+	}
+	return nil
+}
+
+func seasonalViolationKey(deviceID string) string {
+	return fmt.Sprintf("nest:%s:seasonal_violation", deviceID)
+}
+
+// checkSeasonalMode alerts as soon as a device's HVAC state is one the rule
+// for the current month doesn't expect. The violated rule is remembered so
+// it alerts once until the state is back to normal.
+func (m *Monitor) checkSeasonalMode(ctx context.Context, deviceID string, sample Sample) error {
+	var rule *SeasonalModeRule
+	for _, r := range m.config().SeasonalModeRules {
+		if r.covers(sample.Ts.Month()) {
+			rule = &r
+			break
+		}
+	}
+
+	key := seasonalViolationKey(deviceID)
+	if rule == nil || slices.Contains(rule.ExpectedModes, sample.HvacState) {
+		return m.rdb.Del(ctx, key).Err()
+	}
+
+	// SetNX only succeeds for a new violation.
+	isNew, err := m.rdb.SetNX(ctx, key, rule.Name, 0).Result()
+	if err != nil || !isNew {
+		return err
+	}
+	m.logger.Warn("hvac state out of season", "device_id", deviceID, "rule", rule.Name, "hvac_state", sample.HvacState)
+	m.Alert(ctx, AlertEvent{
+		Type:     AlertSeasonalMode,
+		DeviceID: deviceID,
+		Message: fmt.Sprintf("HVAC is %s, but season rule %q expects %s",
+			sample.HvacState, rule.Name, strings.Join(rule.ExpectedModes, " or ")),
+		Priority: rule.AlertPriority,
+		Occupied: sample.Occupied,
+	})
+	return nil
+}
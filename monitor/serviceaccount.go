@@ -0,0 +1,40 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// sdmScope is the OAuth scope the SDM API needs.
+const sdmScope = "https://www.googleapis.com/auth/sdm.service"
+
+// refreshAccessTokenServiceAccount fetches an access token scoped to the SDM
+// API for the service account key in service_account_key_file. Signing the
+// assertion and exchanging it is left to the oauth2 JWT token source, which
+// sends the exchange through the TokenManager's client; caching stays with
+// the TokenManager.
+func (t *TokenManager) refreshAccessTokenServiceAccount(ctx context.Context) (string, time.Duration, error) {
+	keyJSON, err := os.ReadFile(t.configs.Load().ServiceAccountKeyFile)
+	if err != nil {
+		return "", 0, err
+	}
+	jwtCfg, err := google.JWTConfigFromJSON(keyJSON, sdmScope)
+	if err != nil {
+		return "", 0, fmt.Errorf("parsing service account key: %w", err)
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, t.client)
+	token, err := jwtCfg.TokenSource(ctx).Token()
+	if err != nil {
+		return "", 0, err
+	}
+	lifetime := accessTokenLifetime
+	if !token.Expiry.IsZero() {
+		lifetime = time.Until(token.Expiry)
+	}
+	return token.AccessToken, lifetime, nil
+}
@@ -0,0 +1,94 @@
+package monitor
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeServiceAccountKey writes a JSON key for a new RSA key and returns its
+// path.
+func writeServiceAccountKey(t *testing.T) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "monitor@test-project.iam.gserviceaccount.com",
+		"private_key_id": "key1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":      "https://oauth2.googleapis.com/token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestServiceAccountToken(t *testing.T) {
+	var claims map[string]any
+	tm := testTokenManager(t, map[string]any{"service_account_key_file": writeServiceAccountKey(t)}, func(r *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(body))
+		if grant := form.Get("grant_type"); grant != "urn:ietf:params:oauth:grant-type:jwt-bearer" {
+			t.Errorf("grant_type = %q, want jwt-bearer", grant)
+		}
+		if parts := strings.Split(form.Get("assertion"), "."); len(parts) == 3 {
+			data, _ := base64.RawURLEncoding.DecodeString(parts[1])
+			json.Unmarshal(data, &claims)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"access_token": "sa-token", "token_type": "Bearer", "expires_in": 3600}`)),
+			Request:    r,
+		}, nil
+	})
+
+	token, lifetime, err := tm.refresh(context.Background())
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if token != "sa-token" || lifetime < 59*time.Minute || lifetime > time.Hour {
+		t.Errorf("refresh = %q, %v, want sa-token for an hour", token, lifetime)
+	}
+	if claims["iss"] != "monitor@test-project.iam.gserviceaccount.com" || claims["scope"] != sdmScope {
+		t.Errorf("assertion claims = %v, want the service account with the SDM scope", claims)
+	}
+}
+
+func TestServiceAccountTokenBadKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.json")
+	if err := os.WriteFile(path, []byte(`{"type": "service_account"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tm := testTokenManager(t, map[string]any{"service_account_key_file": path}, func(r *http.Request) (*http.Response, error) {
+		t.Errorf("sent %s %s with a bad key", r.Method, r.URL)
+		return nil, io.EOF
+	})
+	if _, _, err := tm.refresh(context.Background()); err == nil {
+		t.Error("refresh with a key missing private_key succeeded")
+	}
+}
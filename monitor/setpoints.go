@@ -0,0 +1,104 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const setpointHistoryLen = 30
+
+// statusSetpointHistoryLen is how many of the latest setpoint changes Status
+// includes per device.
+const statusSetpointHistoryLen = 5
+
+// setpointHistoryKey is the list of a device's setpoint changes, newest
+// first.
+func setpointHistoryKey(deviceID string) string {
+	return fmt.Sprintf("nest:%s:setpoint_history", deviceID)
+}
+
+// SetpointChange is an entry in a device's setpoint history.
+type SetpointChange struct {
+	OldHeat float64 `json:"old_heat"`
+	OldCool float64 `json:"old_cool"`
+	NewHeat float64 `json:"new_heat"`
+	NewCool float64 `json:"new_cool"`
+	Ts      string  `json:"ts"`
+}
+
+// SetpointBounds is the acceptable setpoint range, in the device's display
+// unit. A setpoint of zero means it isn't in use for the current mode.
+type SetpointBounds struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+func (b *SetpointBounds) contains(v float64) bool {
+	return v == 0 || (v >= b.Min && v <= b.Max)
+}
+
+// trackSetpoints records a history entry whenever the setpoints differ from
+// the ones seen on the previous poll, e.g. after a change from the app or a
+// schedule.
+func (m *Monitor) trackSetpoints(ctx context.Context, deviceID string, sample Sample) error {
+	cfg := m.config().forDevice(deviceID)
+	heat, cool := sample.Heat, sample.Cool
+	key := fmt.Sprintf("nest:%s:last_setpoints", deviceID)
+
+	// The read is queued before the write, so it still sees the previous values.
+	var getAll *redis.MapStringStringCmd
+	_, err := m.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		getAll = p.HGetAll(ctx, key)
+		p.HSet(ctx, key, "heat", heat, "cool", cool)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("updating last setpoints: %w", err)
+	}
+	last := getAll.Val()
+	if len(last) == 0 {
+		return nil
+	}
+
+	oldHeat, _ := strconv.ParseFloat(last["heat"], 64)
+	oldCool, _ := strconv.ParseFloat(last["cool"], 64)
+	if oldHeat == heat && oldCool == cool {
+		return nil
+	}
+
+	change := SetpointChange{
+		OldHeat: oldHeat,
+		OldCool: oldCool,
+		NewHeat: heat,
+		NewCool: cool,
+		Ts:      time.Now().Format(time.RFC3339),
+	}
+	m.recordEvent(ctx, deviceID, EventSetpoints, fmt.Sprintf("heat %.1f -> %.1f, cool %.1f -> %.1f", oldHeat, heat, oldCool, cool))
+	data, _ := json.Marshal(change)
+	historyKey := setpointHistoryKey(deviceID)
+	_, err = m.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.LPush(ctx, historyKey, data)
+		p.LTrim(ctx, historyKey, 0, setpointHistoryLen-1)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("recording setpoint change: %w", err)
+	}
+
+	m.logger.Info("setpoints changed", "device_id", deviceID, "old_heat", oldHeat, "old_cool", oldCool, "new_heat", heat, "new_cool", cool)
+
+	if b := cfg.SetpointBounds; b != nil && (!b.contains(heat) || !b.contains(cool)) {
+		m.Alert(ctx, AlertEvent{
+			Type:     AlertSetpointOutOfBounds,
+			DeviceID: deviceID,
+			Message:  fmt.Sprintf("Setpoints changed to heat %.1f/cool %.1f, outside allowed range %.1f-%.1f", heat, cool, b.Min, b.Max),
+			Occupied: sample.Occupied,
+		})
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package monitor
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// traitLogLimit truncates raw trait JSON in logs.
+const traitLogLimit = 500
+
+const temperatureTrait = "sdm.devices.traits.Temperature"
+
+func traitSignaturesKey(deviceID string) string {
+	return fmt.Sprintf("nest:%s:trait_signatures", deviceID)
+}
+
+// traitSignature is an MD5 of the shape of a trait's JSON: its field names
+// and value types, but not the values, which change on every reading.
+func traitSignature(raw json.RawMessage) string {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return ""
+	}
+	var b strings.Builder
+	writeShape(&b, v)
+	sum := md5.Sum([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+func writeShape(b *strings.Builder, v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.WriteByte('{')
+		for _, k := range keys {
+			b.WriteString(k)
+			b.WriteByte(':')
+			writeShape(b, v[k])
+			b.WriteByte(',')
+		}
+		b.WriteByte('}')
+	case []any:
+		b.WriteByte('[')
+		if len(v) > 0 {
+			writeShape(b, v[0])
+		}
+		b.WriteByte(']')
+	case string:
+		b.WriteByte('s')
+	case float64:
+		b.WriteByte('n')
+	case bool:
+		b.WriteByte('b')
+	default:
+		b.WriteString("null")
+	}
+}
+
+// checkTraitSignatures compares the shape of each of d's traits with the one
+// seen last time, logging any that changed, which usually means Google has
+// changed the API. It reports whether d's readings should be trusted: a
+// changed Temperature trait that now parses to zero most likely moved the
+// field.
+func (m *Monitor) checkTraitSignatures(ctx context.Context, d *Device) (bool, error) {
+	key := traitSignaturesKey(d.ID)
+	sigs := make(map[string]any, len(d.Traits))
+	for name, raw := range d.Traits {
+		sigs[name] = traitSignature(raw)
+	}
+
+	var getAll *redis.MapStringStringCmd
+	_, err := m.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		getAll = p.HGetAll(ctx, key)
+		if len(sigs) > 0 {
+			p.HSet(ctx, key, sigs)
+		}
+		return nil
+	})
+	if err != nil {
+		return true, fmt.Errorf("updating trait signatures: %w", err)
+	}
+
+	old := getAll.Val()
+	trusted := true
+	for name, sig := range sigs {
+		prev, ok := old[name]
+		if !ok || prev == sig {
+			continue
+		}
+		raw := string(d.Traits[name])
+		if len(raw) > traitLogLimit {
+			raw = raw[:traitLogLimit]
+		}
+		m.logger.Info("trait schema changed", "device_id", d.ID, "trait", name, "raw", raw)
+		if name == temperatureTrait && d.Ambient == 0 {
+			m.logger.Warn("ambient reads zero after a trait schema change, skipping anomaly detection", "device_id", d.ID, "trait", name)
+			trusted = false
+		}
+	}
+	return trusted, nil
+}
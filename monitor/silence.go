@@ -0,0 +1,72 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// lastAmbientChangeKey holds the Unix time the device's ambient reading last
+// changed.
+func lastAmbientChangeKey(deviceID string) string {
+	return fmt.Sprintf("nest:%s:last_ambient_change_ts", deviceID)
+}
+
+// silenceAlertedKey marks a frozen sensor that has already been alerted on.
+func silenceAlertedKey(deviceID string) string {
+	return fmt.Sprintf("nest:%s:silence_alerted", deviceID)
+}
+
+// checkSilence alerts when the ambient reading hasn't moved for
+// device_silence_alert_minutes while the HVAC is running, which suggests the
+// sensor is frozen rather than the room being perfectly steady. samples is
+// the stored window, newest first, including sample.
+func (m *Monitor) checkSilence(ctx context.Context, deviceID string, sample Sample, samples []Sample) error {
+	key := lastAmbientChangeKey(deviceID)
+	if len(samples) < 2 || samples[1].Ambient != sample.Ambient {
+		_, err := m.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+			p.Set(ctx, key, sample.Ts.Unix(), 0)
+			p.Del(ctx, silenceAlertedKey(deviceID))
+			return nil
+		})
+		return err
+	}
+
+	v, err := m.rdb.Get(ctx, key).Result()
+	if err == redis.Nil {
+		// Not tracked yet; start the clock now.
+		return m.rdb.Set(ctx, key, sample.Ts.Unix(), 0).Err()
+	}
+	if err != nil {
+		return err
+	}
+	ts, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", key, err)
+	}
+	silent := sample.Ts.Sub(time.Unix(ts, 0))
+	limit := time.Duration(m.config().forDevice(deviceID).DeviceSilenceAlertMinutes) * time.Minute
+	if silent <= limit || hvacActive(sample) == 0 {
+		return nil
+	}
+
+	// SetNX only succeeds the first time for each silence.
+	isNew, err := m.rdb.SetNX(ctx, silenceAlertedKey(deviceID), ts, 0).Result()
+	if err != nil || !isNew {
+		return err
+	}
+	m.logger.Warn("ambient reading frozen", "device_id", deviceID, "ambient", sample.Ambient, "silent", silent.Round(time.Minute))
+	ambient := sample.Ambient
+	m.Alert(ctx, AlertEvent{
+		Type:     AlertDeviceSilent,
+		DeviceID: deviceID,
+		Message: fmt.Sprintf("Sensor appears frozen: ambient has been %.1f for %s while %s",
+			sample.Ambient, silent.Round(time.Minute), sample.HvacState),
+		Ambient:  &ambient,
+		Occupied: sample.Occupied,
+	})
+	return nil
+}
@@ -0,0 +1,50 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SimulatedDeviceID is the fake device SimulateAnomaly feeds samples for.
+// Alerts for it are marked as simulated and it is never sent commands.
+const SimulatedDeviceID = "SIMULATE-001"
+
+// SimulateAnomaly runs a synthetic trend of the given alert type through the
+// same path as real samples, so alerts, notifiers and Redis writes can be
+// checked end to end without touching the SDM API. The simulated device's
+// Redis state is cleared before and after.
+func (m *Monitor) SimulateAnomaly(ctx context.Context, alertType string) error {
+	var hvac string
+	var ambient []float64
+	switch alertType {
+	case AlertCoolingRising:
+		hvac, ambient = "COOLING", []float64{24.0, 24.5, 25.0, 25.5, 26.0}
+	case AlertHeatingFalling:
+		hvac, ambient = "HEATING", []float64{20.0, 19.5, 19.0, 18.5, 18.0}
+	default:
+		return fmt.Errorf("can't simulate %q; use %s or %s", alertType, AlertCoolingRising, AlertHeatingFalling)
+	}
+	window := m.config().SampleWindow
+	if window > len(ambient) {
+		return fmt.Errorf("sample_window %d is larger than the simulation supports", window)
+	}
+
+	if _, err := m.ResetDevice(ctx, SimulatedDeviceID); err != nil {
+		return err
+	}
+	defer m.ResetDevice(ctx, SimulatedDeviceID)
+
+	start := time.Now().Add(-time.Duration(window) * time.Minute).Truncate(time.Second)
+	for i := 0; i < window; i++ {
+		sample := Sample{
+			Ambient:   ambient[i],
+			HvacState: hvac,
+			Ts:        start.Add(time.Duration(i) * time.Minute),
+		}
+		if err := m.handleDeviceSamples(ctx, SimulatedDeviceID, sample, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
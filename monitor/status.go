@@ -0,0 +1,231 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	lastPollKey = "nest:last_poll"
+	// recentErrorsKey lists the latest alerts that aren't tied to a device,
+	// such as token or fetch failures.
+	recentErrorsKey = "nest:errors"
+	recentErrorsLen = 20
+)
+
+// MonitorStatus is a snapshot of the monitor's state, as stored in Redis.
+type MonitorStatus struct {
+	LastPollTime time.Time     `json:"last_poll_time"`
+	DeviceStates []DeviceState `json:"device_states"`
+	ActiveAlerts []AlertEvent  `json:"active_alerts"`
+	Errors       []string      `json:"errors"`
+	// PushoverMonthlyCount is how many Pushover messages were sent this
+	// month, when Pushover is configured.
+	PushoverMonthlyCount *int `json:"pushover_monthly_count,omitempty"`
+}
+
+// DeviceState is the latest known state of one device.
+type DeviceState struct {
+	DeviceID      string     `json:"device_id"`
+	Alias         string     `json:"alias,omitempty"`
+	Ambient       float64    `json:"ambient"`
+	Heat          float64    `json:"heat"`
+	Cool          float64    `json:"cool"`
+	HvacState     string     `json:"hvac_state"`
+	Connectivity  string     `json:"connectivity,omitempty"`
+	SampleTime    time.Time  `json:"sample_time"`
+	LastAlertTime *time.Time `json:"last_alert_time,omitempty"`
+	AnomalyActive bool       `json:"anomaly_active"`
+	// AvailableModes is only known once the device has been fetched by this
+	// process.
+	AvailableModes []string `json:"available_modes,omitempty"`
+	// Schedule is the programmed schedule, with the same caveat.
+	Schedule *ThermostatSchedule `json:"schedule,omitempty"`
+	// SetpointHistory is the latest setpoint changes, newest first.
+	SetpointHistory []SetpointChange `json:"setpoint_history,omitempty"`
+}
+
+// recordPoll marks the end of a poll of all devices.
+func (m *Monitor) recordPoll(ctx context.Context) {
+	if err := m.rdb.Set(ctx, lastPollKey, time.Now().Format(time.RFC3339), 0).Err(); err != nil {
+		m.logger.Warn("failed to record poll time", "err", err)
+	}
+}
+
+// recordAlert keeps each device's alert history, and recent alerts that
+// aren't tied to a device, for Status and ListAlertHistory.
+func (m *Monitor) recordAlert(ctx context.Context, event AlertEvent) {
+	if m.rdb == nil {
+		return
+	}
+	var err error
+	if event.DeviceID == "N/A" {
+		entry := fmt.Sprintf("%s %s: %s", event.Time.Format(time.RFC3339), event.Type, event.Message)
+		_, err = m.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+			p.LPush(ctx, recentErrorsKey, entry)
+			p.LTrim(ctx, recentErrorsKey, 0, recentErrorsLen-1)
+			return nil
+		})
+	} else {
+		data, _ := json.Marshal(event)
+		key := alertsKey(event.DeviceID)
+		_, err = m.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+			p.LPush(ctx, key, data)
+			p.LTrim(ctx, key, 0, alertHistoryLen-1)
+			return nil
+		})
+	}
+	if err != nil {
+		m.logger.Warn("failed to record alert", "type", event.Type, "device_id", event.DeviceID, "err", err)
+	}
+}
+
+// Status returns the state of every device that has stored samples, without
+// calling the SDM API. Redis errors are reported in Errors rather than
+// failing the whole snapshot.
+func (m *Monitor) Status() MonitorStatus {
+	ctx := context.Background()
+	cfg := m.config()
+	status := MonitorStatus{DeviceStates: []DeviceState{}, ActiveAlerts: []AlertEvent{}}
+
+	if v, err := m.rdb.Get(ctx, lastPollKey).Result(); err == nil {
+		status.LastPollTime, _ = time.Parse(time.RFC3339, v)
+	} else if err != redis.Nil {
+		status.Errors = append(status.Errors, "last poll: "+err.Error())
+	}
+
+	iter := m.rdb.Scan(ctx, 0, samplesKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		deviceID := strings.TrimSuffix(strings.TrimPrefix(iter.Val(), "nest:"), ":temps")
+		state, alert, err := m.deviceState(ctx, cfg, deviceID)
+		if err != nil {
+			status.Errors = append(status.Errors, fmt.Sprintf("%s: %v", deviceID, err))
+			continue
+		}
+		status.DeviceStates = append(status.DeviceStates, state)
+		if state.AnomalyActive && alert != nil {
+			status.ActiveAlerts = append(status.ActiveAlerts, *alert)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		status.Errors = append(status.Errors, "listing devices: "+err.Error())
+	}
+
+	if cfg.PushoverToken != "" {
+		if n, err := PushoverMonthlyCount(ctx, m.rdb.Client); err == nil {
+			status.PushoverMonthlyCount = &n
+		} else {
+			status.Errors = append(status.Errors, "pushover count: "+err.Error())
+		}
+	}
+
+	recent, err := m.rdb.LRange(ctx, recentErrorsKey, 0, -1).Result()
+	if err != nil {
+		status.Errors = append(status.Errors, "recent errors: "+err.Error())
+	}
+	status.Errors = append(status.Errors, recent...)
+	return status
+}
+
+// deviceState reads a device's latest sample, active anomaly, last alert and
+// recent setpoint changes.
+func (m *Monitor) deviceState(ctx context.Context, cfg *Config, deviceID string) (DeviceState, *AlertEvent, error) {
+	var latest *redis.StringCmd
+	var active *redis.StringCmd
+	var lastAlert *redis.StringCmd
+	var setpoints *redis.StringSliceCmd
+	_, err := m.rdb.Pipelined(ctx, func(p redis.Pipeliner) error {
+		latest = p.LIndex(ctx, samplesKey(deviceID), 0)
+		active = p.Get(ctx, activeAnomalyKey(deviceID))
+		lastAlert = p.LIndex(ctx, alertsKey(deviceID), 0)
+		setpoints = p.LRange(ctx, setpointHistoryKey(deviceID), 0, statusSetpointHistoryLen-1)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return DeviceState{}, nil, err
+	}
+
+	state := DeviceState{DeviceID: deviceID, Alias: cfg.DeviceAliases[deviceID]}
+	if sample, err := decodeSample(latest.Val()); err == nil {
+		state.Ambient = sample.Ambient
+		state.Heat = sample.Heat
+		state.Cool = sample.Cool
+		state.HvacState = sample.HvacState
+		state.Connectivity = sample.Connectivity
+		state.SampleTime = sample.Ts
+	}
+	state.AnomalyActive = active.Val() != ""
+	for _, v := range setpoints.Val() {
+		var change SetpointChange
+		if err := json.Unmarshal([]byte(v), &change); err == nil {
+			state.SetpointHistory = append(state.SetpointHistory, change)
+		}
+	}
+	if d := m.traits.device(m.deviceName(deviceID)); d != nil {
+		state.AvailableModes = d.AvailableModes
+		state.Schedule = d.Schedule
+	}
+
+	var alert *AlertEvent
+	if v := lastAlert.Val(); v != "" {
+		alert = new(AlertEvent)
+		if err := json.Unmarshal([]byte(v), alert); err != nil {
+			alert = nil
+		} else {
+			state.LastAlertTime = &alert.Time
+		}
+	}
+	return state, alert, nil
+}
+
+// Handler serves the monitor's HTTP endpoints:
+//
+//	GET /status                  the Status snapshot as JSON
+//	GET /healthz                 health check results, with the running version
+//	GET /chart/{deviceID}        an SVG sparkline of ambient and setpoints
+//	GET /metrics                 Prometheus metrics
+//	POST /events/sdm             Pub/Sub push delivery of SDM events
+//	GET /events/{deviceID}       the device's state change log
+//	GET /alerts/{deviceID}       the device's alert history
+//	DELETE /alerts/{deviceID}    clear the device's alerts (needs X-Admin-Token)
+//	POST /alerts/{deviceID}/ack  acknowledge its alert (needs X-Admin-Token)
+//	POST /emergency-shutoff      turn every thermostat off (needs X-Admin-Token)
+//	GET /debug/pprof/            Go profiles, with WithProfiling (needs X-Admin-Token)
+func (m *Monitor) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m.Status())
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		healthy, failures := m.health.Healthy()
+		if healthy {
+			json.NewEncoder(w).Encode(map[string]string{"status": "ok", "version": Version})
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]any{"status": "unhealthy", "version": Version, "failures": failures})
+	})
+	mux.HandleFunc("/chart/", m.serveChart)
+	mux.HandleFunc("/events/sdm", m.servePushEvent)
+	mux.HandleFunc("/events/", m.serveDeviceEvents)
+	mux.HandleFunc("/alerts/", m.serveAlerts)
+	mux.HandleFunc("/emergency-shutoff", m.serveEmergencyShutoff)
+	mux.Handle("/metrics", promhttp.HandlerFor(m.metrics.registry, promhttp.HandlerOpts{}))
+	if m.profile {
+		mux.Handle("/debug/pprof/", m.ProfileHandler())
+	}
+	return mux
+}
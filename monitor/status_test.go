@@ -0,0 +1,32 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStatusIncludesSetpointHistory(t *testing.T) {
+	tm := newTestMonitor(t, testConfig(t, nil), nil)
+	ctx := context.Background()
+	for _, heat := range []float64{20, 21, 22} {
+		d := testDevice(t, "dev1", 21, "OFF", heat)
+		if errs := tm.processDevices(ctx, []Device{d}, "token"); len(errs) > 0 {
+			t.Fatalf("processDevices: %v", errs)
+		}
+	}
+
+	status := tm.Status()
+	if len(status.DeviceStates) != 1 {
+		t.Fatalf("got %d device states, want 1", len(status.DeviceStates))
+	}
+	history := status.DeviceStates[0].SetpointHistory
+	if len(history) != 2 {
+		t.Fatalf("setpoint history = %+v, want 2 changes", history)
+	}
+	if h := history[0]; h.OldHeat != 21 || h.NewHeat != 22 {
+		t.Errorf("newest change = %+v, want heat 21 -> 22", h)
+	}
+	if h := history[1]; h.OldHeat != 20 || h.NewHeat != 21 {
+		t.Errorf("oldest change = %+v, want heat 20 -> 21", h)
+	}
+}
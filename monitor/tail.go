@@ -0,0 +1,95 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+)
+
+// tailPollInterval is how often TailAlerts checks the alert lists when
+// alerts aren't published to Redis.
+const tailPollInterval = 2 * time.Second
+
+// TailAlerts calls fn for each new alert until ctx is cancelled. With
+// publish_alerts_to_redis set it subscribes to redis_pubsub_channel, which
+// also carries alerts that aren't tied to a device; otherwise it polls every
+// device's alert history.
+func (m *Monitor) TailAlerts(ctx context.Context, fn func(AlertEvent)) error {
+	cfg := m.config()
+	if cfg.PublishAlertsToRedis {
+		return m.subscribeAlerts(ctx, cfg.RedisPubSubChannel, fn)
+	}
+	return m.pollAlerts(ctx, fn)
+}
+
+func (m *Monitor) subscribeAlerts(ctx context.Context, channel string, fn func(AlertEvent)) error {
+	sub := m.rdb.Subscribe(ctx, channel)
+	defer sub.Close()
+	// Wait for the subscription, so a bad address fails here rather than
+	// looking like a quiet channel.
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+	msgs := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-msgs:
+			if !ok {
+				return nil
+			}
+			var e AlertEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+				m.logger.Warn("dropping malformed alert", "channel", channel, "err", err)
+				continue
+			}
+			fn(e)
+		}
+	}
+}
+
+// pollAlerts reports alerts added to any device's history since the
+// previous poll. Alerts already there when it starts are skipped.
+func (m *Monitor) pollAlerts(ctx context.Context, fn func(AlertEvent)) error {
+	seen := map[string]time.Time{}
+	first := true
+	for {
+		var keys []string
+		iter := m.rdb.Scan(ctx, 0, alertsKey("*"), 100).Iterator()
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			deviceID := strings.TrimSuffix(strings.TrimPrefix(key, "nest:"), ":alerts")
+			events, err := m.ListAlertHistory(deviceID, alertHistoryLen)
+			if err != nil {
+				return err
+			}
+			last, known := seen[key]
+			// History is newest first; report oldest first.
+			slices.Reverse(events)
+			for _, e := range events {
+				if !e.Time.After(last) {
+					continue
+				}
+				seen[key] = e.Time
+				if !first || known {
+					fn(e)
+				}
+			}
+		}
+		first = false
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(tailPollInterval):
+		}
+	}
+}
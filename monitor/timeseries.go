@@ -0,0 +1,178 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// timeSeries are the per-device sorted sets recorded for charts and reports,
+// each a function of the sample it's read from. Series without a color aren't
+// charted.
+var timeSeries = []struct {
+	name  string
+	color string
+	value func(Sample) float64
+	// keepZero records zero values, which otherwise mean a setpoint isn't in
+	// use.
+	keepZero bool
+}{
+	{"ambient", "#1f77b4", func(s Sample) float64 { return s.Ambient }, true},
+	{"heat", "#d62728", func(s Sample) float64 { return s.Heat }, false},
+	{"cool", "#17becf", func(s Sample) float64 { return s.Cool }, false},
+	{"hvac", "", hvacActive, true},
+}
+
+// hvacActive is 1 while the HVAC is heating or cooling and 0 otherwise.
+func hvacActive(s Sample) float64 {
+	if s.HvacState == "HEATING" || s.HvacState == "COOLING" {
+		return 1
+	}
+	return 0
+}
+
+func timeSeriesKey(deviceID, series string) string {
+	return fmt.Sprintf("nest:%s:ts:%s", deviceID, series)
+}
+
+// recordTimeSeriesPoint adds sample's ambient, setpoints and HVAC activity to
+// the device's time series, scored by Unix timestamp, and drops points older
+// than retentionDays. Members are "<timestamp>:<value>" so repeated values at
+// different times aren't collapsed. Setpoints of zero aren't in use and are
+// skipped. The commands are queued on p, so they share the caller's round
+// trip.
+func recordTimeSeriesPoint(ctx context.Context, p redis.Pipeliner, deviceID string, sample Sample, retentionDays int) {
+	ts := sample.Ts.Unix()
+	cutoff := strconv.FormatInt(time.Now().Unix()-int64(retentionDays)*86400, 10)
+	for _, series := range timeSeries {
+		key := timeSeriesKey(deviceID, series.name)
+		if v := series.value(sample); v != 0 || series.keepZero {
+			p.ZAdd(ctx, key, redis.Z{Score: float64(ts), Member: fmt.Sprintf("%d:%g", ts, v)})
+		}
+		p.ZRemRangeByScore(ctx, key, "-inf", "("+cutoff)
+	}
+}
+
+type chartPoint struct {
+	ts    float64
+	value float64
+}
+
+// readTimeSeries returns a series' points since the given Unix time, in time
+// order.
+func (m *Monitor) readTimeSeries(ctx context.Context, deviceID, series string, since int64) ([]chartPoint, error) {
+	members, err := m.rdb.ZRangeByScoreWithScores(ctx, timeSeriesKey(deviceID, series), &redis.ZRangeBy{
+		Min: strconv.FormatInt(since, 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	points := make([]chartPoint, 0, len(members))
+	for _, z := range members {
+		member, _ := z.Member.(string)
+		_, value, ok := strings.Cut(member, ":")
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		points = append(points, chartPoint{ts: z.Score, value: v})
+	}
+	return points, nil
+}
+
+const (
+	chartWidth  = 600
+	chartHeight = 150
+	chartMargin = 5
+)
+
+// sparkline renders each series as an SVG path on shared axes.
+func sparkline(series map[string][]chartPoint) string {
+	minT, maxT := math.Inf(1), math.Inf(-1)
+	minV, maxV := math.Inf(1), math.Inf(-1)
+	for _, points := range series {
+		for _, p := range points {
+			minT, maxT = math.Min(minT, p.ts), math.Max(maxT, p.ts)
+			minV, maxV = math.Min(minV, p.value), math.Max(maxV, p.value)
+		}
+	}
+	if maxT == minT {
+		maxT = minT + 1
+	}
+	if maxV == minV {
+		maxV = minV + 1
+	}
+	x := func(t float64) float64 {
+		return chartMargin + (t-minT)/(maxT-minT)*(chartWidth-2*chartMargin)
+	}
+	y := func(v float64) float64 {
+		return chartHeight - chartMargin - (v-minV)/(maxV-minV)*(chartHeight-2*chartMargin)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, chartWidth, chartHeight, chartWidth, chartHeight)
+	for _, ts := range timeSeries {
+		points := series[ts.name]
+		if len(points) == 0 || ts.color == "" {
+			continue
+		}
+		fmt.Fprintf(&b, `<path fill="none" stroke="%s" stroke-width="1.5" d="`, ts.color)
+		for i, p := range points {
+			cmd := "L"
+			if i == 0 {
+				cmd = "M"
+			}
+			fmt.Fprintf(&b, "%s%.1f %.1f ", cmd, x(p.ts), y(p.value))
+		}
+		b.WriteString(`"/>`)
+	}
+	b.WriteString("</svg>")
+	return b.String()
+}
+
+// serveChart serves /chart/{deviceID} as an SVG sparkline of the device's
+// ambient temperature and setpoints.
+func (m *Monitor) serveChart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	deviceID := strings.TrimPrefix(r.URL.Path, "/chart/")
+	if deviceID == "" || strings.Contains(deviceID, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	series := make(map[string][]chartPoint, len(timeSeries))
+	total := 0
+	for _, ts := range timeSeries {
+		if ts.color == "" {
+			continue
+		}
+		points, err := m.readTimeSeries(r.Context(), deviceID, ts.name, 0)
+		if err != nil {
+			m.logger.Error("failed to read time series", "device_id", deviceID, "series", ts.name, "err", err)
+			http.Error(w, "failed to read time series", http.StatusInternalServerError)
+			return
+		}
+		series[ts.name] = points
+		total += len(points)
+	}
+	if total == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	fmt.Fprint(w, sparkline(series))
+}
@@ -0,0 +1,186 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenExpiryMargin is how long before its expiry a cached access token is
+// refreshed, so it never expires in the middle of a poll.
+const tokenExpiryMargin = 5 * time.Minute
+
+// TokenManager caches the OAuth access token and refreshes it when it is
+// about to expire or has been invalidated.
+type TokenManager struct {
+	configs *configStore
+	client  *http.Client
+	logger  *slog.Logger
+
+	// OnRefresh is called after each successful refresh.
+	OnRefresh func()
+	// OnError is called when every refresh attempt has failed.
+	OnError func(ctx context.Context, attempts int, err error)
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+	// inflight is the refresh in progress, if any. Callers that find the
+	// token expired while it runs wait for its result instead of starting
+	// their own.
+	inflight *tokenRefresh
+}
+
+// tokenRefresh is the outcome of one refresh, available once done is closed.
+type tokenRefresh struct {
+	done  chan struct{}
+	token string
+	err   error
+	// canceled is set when the refresh failed because the context of the
+	// caller running it was done, which says nothing about other callers.
+	canceled bool
+}
+
+func newTokenManager(configs *configStore, client *http.Client, logger *slog.Logger) *TokenManager {
+	return &TokenManager{configs: configs, client: client, logger: logger}
+}
+
+// Get returns the cached access token if it is still valid, and otherwise
+// refreshes it, retrying with exponential backoff up to
+// max_token_refresh_retries times. Only one refresh runs at a time; the lock
+// isn't held while it runs, and waiting for it or for a backoff stops when
+// ctx is done.
+func (t *TokenManager) Get(ctx context.Context) (string, error) {
+	for {
+		t.mu.Lock()
+		if t.token != "" && time.Now().Before(t.expiresAt) {
+			token := t.token
+			t.mu.Unlock()
+			return token, nil
+		}
+		if r := t.inflight; r != nil {
+			t.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-r.done:
+			}
+			if r.canceled {
+				continue
+			}
+			return r.token, r.err
+		}
+		r := &tokenRefresh{done: make(chan struct{})}
+		t.inflight = r
+		t.mu.Unlock()
+
+		var lifetime time.Duration
+		r.token, lifetime, r.err = t.refreshWithRetries(ctx)
+		r.canceled = r.err != nil && ctx.Err() != nil
+
+		t.mu.Lock()
+		t.inflight = nil
+		if r.err == nil {
+			t.token, t.expiresAt = r.token, time.Now().Add(lifetime-tokenExpiryMargin)
+		}
+		t.mu.Unlock()
+		close(r.done)
+		return r.token, r.err
+	}
+}
+
+// refreshWithRetries calls refresh until it succeeds or has been tried
+// max_token_refresh_retries times.
+func (t *TokenManager) refreshWithRetries(ctx context.Context) (string, time.Duration, error) {
+	cfg := t.configs.Load()
+	var err error
+	// MaxTokenRefreshRetries counts every attempt, including the first.
+	for attempt := 1; attempt <= cfg.MaxTokenRefreshRetries; attempt++ {
+		var token string
+		var lifetime time.Duration
+		token, lifetime, err = t.refresh(ctx)
+		if err == nil {
+			if t.OnRefresh != nil {
+				t.OnRefresh()
+			}
+			return token, lifetime, nil
+		}
+
+		if attempt < cfg.MaxTokenRefreshRetries {
+			// Exponential backoff: base, 2×base, 4×base, ...
+			select {
+			case <-ctx.Done():
+				return "", 0, ctx.Err()
+			case <-time.After(time.Duration(cfg.TokenRetryBackoffBaseSeconds*(1<<(attempt-1))) * time.Second):
+			}
+		}
+	}
+
+	if t.OnError != nil {
+		t.OnError(ctx, cfg.MaxTokenRefreshRetries, err)
+	}
+	return "", 0, err
+}
+
+// Invalidate drops the cached token, so the next Get refreshes it. It is
+// used when the SDM API rejects a token before it was due to expire.
+func (t *TokenManager) Invalidate() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.token, t.expiresAt = "", time.Time{}
+}
+
+// refresh fetches a new access token, returning how long it is valid for.
+// It uses the service account key when one is configured, and the user's
+// refresh token otherwise.
+func (t *TokenManager) refresh(ctx context.Context) (string, time.Duration, error) {
+	cfg := t.configs.Load()
+	if cfg.ServiceAccountKeyFile != "" {
+		return t.refreshAccessTokenServiceAccount(ctx)
+	}
+	form := url.Values{
+		"client_id":     {cfg.ClientID},
+		"client_secret": {cfg.ClientSecret},
+		"refresh_token": {cfg.RefreshToken},
+		"grant_type":    {"refresh_token"},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://oauth2.googleapis.com/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return t.exchange(req)
+}
+
+// exchange sends a token request and reads the access token from the
+// response.
+func (t *TokenManager) exchange(req *http.Request) (string, time.Duration, error) {
+	resp, err := doRequest(t.client, t.logger, req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", 0, err
+	}
+	if resp.StatusCode != 200 || tokenResp.AccessToken == "" {
+		return "", 0, fmt.Errorf("token endpoint returned status %d: %s", resp.StatusCode, tokenResp.Error)
+	}
+	lifetime := accessTokenLifetime
+	if tokenResp.ExpiresIn > 0 {
+		lifetime = time.Duration(tokenResp.ExpiresIn) * time.Second
+	}
+	return tokenResp.AccessToken, lifetime, nil
+}
@@ -0,0 +1,144 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testTokenManager returns a TokenManager whose token endpoint is answered
+// by rt.
+func testTokenManager(t *testing.T, fields map[string]any, rt roundTripFunc) *TokenManager {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return newTokenManager(newConfigStore(testConfig(t, fields)), &http.Client{Transport: rt}, logger)
+}
+
+func TestTokenBackoffStopsWithContext(t *testing.T) {
+	// Three attempts, a minute apart.
+	tm := testTokenManager(t, map[string]any{"token_retry_backoff_base_seconds": 60}, func(r *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := tm.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Get error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Get took %v after its context was done", elapsed)
+	}
+}
+
+func TestTokenRefreshIsShared(t *testing.T) {
+	var requests atomic.Int32
+	release := make(chan struct{})
+	tm := testTokenManager(t, nil, func(r *http.Request) (*http.Response, error) {
+		requests.Add(1)
+		<-release
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"access_token": "token", "expires_in": 3600}`)),
+			Request:    r,
+		}, nil
+	})
+
+	var wg sync.WaitGroup
+	tokens := make(chan string, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := tm.Get(context.Background())
+			if err != nil {
+				t.Errorf("Get: %v", err)
+			}
+			tokens <- token
+		}()
+	}
+	for requests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// A caller that gives up doesn't wait for the refresh to finish, and
+	// the lock isn't held while it runs, so Invalidate doesn't block.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := tm.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Get during a refresh: err = %v, want context.DeadlineExceeded", err)
+	}
+	tm.Invalidate()
+
+	close(release)
+	wg.Wait()
+	close(tokens)
+	for token := range tokens {
+		if token != "token" {
+			t.Errorf("Get = %q, want the refreshed token", token)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("sent %d token requests for concurrent callers, want 1", n)
+	}
+}
+
+// staleTokenClient rejects the token "stale" with a 401, as the SDM API does
+// for a revoked token.
+type staleTokenClient struct {
+	*MockThermostatClient
+}
+
+func (c staleTokenClient) FetchDevice(ctx context.Context, token, deviceName string) (Device, error) {
+	if token == "stale" {
+		return Device{}, &APIError{StatusCode: http.StatusUnauthorized}
+	}
+	return c.MockThermostatClient.FetchDevice(ctx, token, deviceName)
+}
+
+func (c staleTokenClient) ExecuteCommand(ctx context.Context, token, deviceName, command string, params map[string]any) error {
+	if token == "stale" {
+		return &APIError{StatusCode: http.StatusUnauthorized}
+	}
+	return c.MockThermostatClient.ExecuteCommand(ctx, token, deviceName, command, params)
+}
+
+func TestRejectedTokenIsReplacedForEveryCall(t *testing.T) {
+	d := testDevice(t, "dev1", 21, "HEAT", 20)
+	client := &MockThermostatClient{Devices: []Device{d}}
+	var refreshes atomic.Int32
+	httpClient := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		refreshes.Add(1)
+		return jsonResponse(http.StatusOK, `{"access_token": "fresh", "expires_in": 3600}`).Transport.RoundTrip(r)
+	})}
+	tm := newTestMonitor(t, testConfig(t, nil), client, WithHTTPClient(httpClient), WithThermostatClient(staleTokenClient{client}))
+	ctx := context.Background()
+
+	for name, call := range map[string]func() error{
+		"fetchDevice": func() error {
+			_, err := tm.fetchDevice(ctx, "stale", "dev1")
+			return err
+		},
+		"executeCommand": func() error {
+			return tm.executeCommand(ctx, "dev1", "sdm.devices.commands.ThermostatMode.SetMode", map[string]any{"mode": "OFF"}, "stale")
+		},
+	} {
+		tm.tokens.token, tm.tokens.expiresAt = "stale", time.Now().Add(time.Hour)
+		refreshes.Store(0)
+		if err := call(); err != nil {
+			t.Errorf("%s with a rejected token: %v", name, err)
+		}
+		if n := refreshes.Load(); n != 1 {
+			t.Errorf("%s refreshed the token %d times, want 1", name, n)
+		}
+	}
+	if n := len(client.commands()); n != 1 {
+		t.Errorf("sent %d commands, want 1", n)
+	}
+}
@@ -0,0 +1,163 @@
+package monitor
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// loadDeviceFixture returns the trait maps of the devices in
+// testdata/devices.json, a devices.list response, as FetchDevices passes
+// them to UnmarshalDevice.
+func loadDeviceFixture(tb testing.TB) []map[string]json.RawMessage {
+	tb.Helper()
+	data, err := os.ReadFile("testdata/devices.json")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var result struct {
+		Devices []Device `json:"devices"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		tb.Fatal(err)
+	}
+	traits := make([]map[string]json.RawMessage, len(result.Devices))
+	for i, d := range result.Devices {
+		traits[i] = d.traitMap()
+	}
+	return traits
+}
+
+// structTraitParser is DefaultTraitParser as it was before it moved to
+// gjson, unmarshalling each trait into a struct. It is kept as the baseline
+// for BenchmarkParseDeviceTraits.
+func structTraitParser() *TraitParser {
+	p := NewTraitParser()
+	p.Register("sdm.devices.traits.Info", func(d *Device, raw json.RawMessage) error {
+		var v struct {
+			CustomName string `json:"customName"`
+		}
+		err := json.Unmarshal(raw, &v)
+		d.CustomName = v.CustomName
+		return err
+	})
+	p.Register("sdm.devices.traits.Connectivity", func(d *Device, raw json.RawMessage) error {
+		var v struct {
+			Status string `json:"status"`
+		}
+		err := json.Unmarshal(raw, &v)
+		d.Connectivity = v.Status
+		return err
+	})
+	p.Register("sdm.devices.traits.ThermostatMode", func(d *Device, raw json.RawMessage) error {
+		var v struct {
+			Mode           string   `json:"mode"`
+			AvailableModes []string `json:"availableModes"`
+		}
+		err := json.Unmarshal(raw, &v)
+		d.Mode, d.AvailableModes = v.Mode, v.AvailableModes
+		return err
+	})
+	p.Register("sdm.devices.traits.ThermostatHvac", func(d *Device, raw json.RawMessage) error {
+		var v struct {
+			Status string `json:"status"`
+		}
+		err := json.Unmarshal(raw, &v)
+		d.HvacState = v.Status
+		return err
+	})
+	p.Register("sdm.devices.traits.ThermostatTemperatureSetpoint", func(d *Device, raw json.RawMessage) error {
+		var v struct {
+			Heat float64 `json:"heatCelsius"`
+			Cool float64 `json:"coolCelsius"`
+		}
+		err := json.Unmarshal(raw, &v)
+		d.Heat, d.Cool = v.Heat, v.Cool
+		return err
+	})
+	p.Register("sdm.devices.traits.Temperature", func(d *Device, raw json.RawMessage) error {
+		var v struct {
+			Ambient float64 `json:"ambientTemperatureCelsius"`
+		}
+		err := json.Unmarshal(raw, &v)
+		d.Ambient = v.Ambient
+		return err
+	})
+	p.Register("sdm.devices.traits.Settings", func(d *Device, raw json.RawMessage) error {
+		var v struct {
+			DisplayTempUnit string `json:"displayTemperatureUnit"`
+		}
+		err := json.Unmarshal(raw, &v)
+		d.Unit = v.DisplayTempUnit
+		return err
+	})
+	p.Register("sdm.devices.traits.Occupancy", func(d *Device, raw json.RawMessage) error {
+		var v struct {
+			Occupied *bool `json:"occupied"`
+		}
+		err := json.Unmarshal(raw, &v)
+		d.Occupied = v.Occupied
+		return err
+	})
+	p.Register("sdm.devices.traits.Humidity", func(d *Device, raw json.RawMessage) error {
+		var v struct {
+			Percent *float64 `json:"ambientHumidityPercent"`
+		}
+		err := json.Unmarshal(raw, &v)
+		d.Humidity = v.Percent
+		return err
+	})
+	p.Register("sdm.devices.traits.Fan", func(d *Device, raw json.RawMessage) error {
+		var v struct {
+			TimerMode string `json:"timerMode"`
+		}
+		err := json.Unmarshal(raw, &v)
+		d.FanTimerMode = v.TimerMode
+		return err
+	})
+	return p
+}
+
+func TestDefaultTraitParserMatchesStructParser(t *testing.T) {
+	baseline := structTraitParser()
+	for _, traits := range loadDeviceFixture(t) {
+		want, err := baseline.Parse(traits)
+		if err != nil {
+			t.Fatalf("struct parser: %v", err)
+		}
+		got, err := UnmarshalDevice(traits)
+		if err != nil {
+			t.Fatalf("UnmarshalDevice: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("UnmarshalDevice = %+v, want %+v", got, want)
+		}
+	}
+}
+
+// BenchmarkParseDeviceTraits parses every device in the fixture per
+// iteration, with the gjson parsers DefaultTraitParser uses and with the
+// struct parsers they replaced.
+func BenchmarkParseDeviceTraits(b *testing.B) {
+	fixture := loadDeviceFixture(b)
+	parsers := []struct {
+		name   string
+		parser *TraitParser
+	}{
+		{"gjson", DefaultTraitParser},
+		{"encoding/json", structTraitParser()},
+	}
+	for _, p := range parsers {
+		b.Run(p.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, traits := range fixture {
+					if _, err := p.parser.Parse(traits); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package monitor
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func rawTraits(t *testing.T, traits map[string]string) map[string]json.RawMessage {
+	t.Helper()
+	raw := make(map[string]json.RawMessage, len(traits))
+	for k, v := range traits {
+		if !json.Valid([]byte(v)) {
+			t.Fatalf("%s: invalid JSON %s", k, v)
+		}
+		raw[k] = json.RawMessage(v)
+	}
+	return raw
+}
+
+func TestDefaultTraitParser(t *testing.T) {
+	traits := rawTraits(t, map[string]string{
+		"deviceName":                                       `"enterprises/p/devices/abc"`,
+		"deviceType":                                       `"sdm.devices.types.THERMOSTAT"`,
+		"sdm.devices.traits.Info":                          `{"customName": "Hallway"}`,
+		"sdm.devices.traits.Connectivity":                  `{"status": "ONLINE"}`,
+		"sdm.devices.traits.Settings":                      `{"displayTemperatureUnit": "FAHRENHEIT"}`,
+		"sdm.devices.traits.Temperature":                   `{"ambientTemperatureCelsius": 20}`,
+		"sdm.devices.traits.ThermostatHvac":                `{"status": "HEATING"}`,
+		"sdm.devices.traits.ThermostatMode":                `{"mode": "HEAT", "availableModes": ["HEAT", "OFF"]}`,
+		"sdm.devices.traits.ThermostatTemperatureSetpoint": `{"heatCelsius": 21}`,
+		"sdm.devices.traits.Humidity":                      `{"ambientHumidityPercent": 40}`,
+		"sdm.devices.traits.Occupancy":                     `{"occupied": false}`,
+		"sdm.devices.traits.Fan":                           `{"timerMode": "ON"}`,
+		"sdm.devices.traits.ParentRelations":               `{"parentRelations": [{"displayName": "Hall"}]}`,
+	})
+
+	d, err := DefaultTraitParser.Parse(traits)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	checks := []struct {
+		name      string
+		got, want any
+	}{
+		{"ID", d.ID, "abc"},
+		{"Type", d.Type, "sdm.devices.types.THERMOSTAT"},
+		{"CustomName", d.CustomName, "Hallway"},
+		{"Connectivity", d.Connectivity, "ONLINE"},
+		{"Unit", d.Unit, "FAHRENHEIT"},
+		{"HvacState", d.HvacState, "HEATING"},
+		{"Mode", d.Mode, "HEAT"},
+		{"AvailableModes", strings.Join(d.AvailableModes, ","), "HEAT,OFF"},
+		{"FanTimerMode", d.FanTimerMode, "ON"},
+		{"Room", d.Room, "Hall"},
+		{"Cool", d.Cool, 0.0},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+	if math.Abs(d.Ambient-68) > 0.001 || math.Abs(d.Heat-69.8) > 0.001 {
+		t.Errorf("ambient, heat = %v, %v, want 68, 69.8 (converted to the display unit)", d.Ambient, d.Heat)
+	}
+	if d.Humidity == nil || *d.Humidity != 40 {
+		t.Errorf("Humidity = %v, want 40", d.Humidity)
+	}
+	if d.Occupied == nil || *d.Occupied {
+		t.Errorf("Occupied = %v, want false", d.Occupied)
+	}
+	if _, ok := d.Traits["deviceName"]; ok {
+		t.Errorf("Traits includes deviceName")
+	}
+}
+
+func TestTraitParserErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		traits map[string]string
+		want   string
+	}{
+		{
+			name:   "missing device name",
+			traits: map[string]string{"sdm.devices.traits.Temperature": `{"ambientTemperatureCelsius": 20}`},
+			want:   "deviceName",
+		},
+		{
+			name: "malformed trait",
+			traits: map[string]string{
+				"deviceName":                     `"enterprises/p/devices/abc"`,
+				"sdm.devices.traits.Temperature": `{"ambientTemperatureCelsius": "warm"}`,
+			},
+			want: "sdm.devices.traits.Temperature",
+		},
+		{
+			name: "trait not an object",
+			traits: map[string]string{
+				"deviceName":                        `"enterprises/p/devices/abc"`,
+				"sdm.devices.traits.ThermostatHvac": `"HEATING"`,
+			},
+			want: "sdm.devices.traits.ThermostatHvac",
+		},
+		{
+			name: "available modes not strings",
+			traits: map[string]string{
+				"deviceName":                        `"enterprises/p/devices/abc"`,
+				"sdm.devices.traits.ThermostatMode": `{"mode": "HEAT", "availableModes": ["HEAT", 2]}`,
+			},
+			want: "availableModes",
+		},
+		{
+			name: "occupied not a boolean",
+			traits: map[string]string{
+				"deviceName":                   `"enterprises/p/devices/abc"`,
+				"sdm.devices.traits.Occupancy": `{"occupied": "yes"}`,
+			},
+			want: "occupied",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DefaultTraitParser.Parse(rawTraits(t, tt.traits))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTraitParserRegister(t *testing.T) {
+	p := NewTraitParser()
+	p.Register("sdm.devices.traits.Beta", func(d *Device, raw json.RawMessage) error {
+		var v struct {
+			Label string `json:"label"`
+		}
+		err := json.Unmarshal(raw, &v)
+		d.CustomName = v.Label
+		return err
+	})
+	traits := rawTraits(t, map[string]string{
+		"deviceName":                     `"enterprises/p/devices/abc"`,
+		"sdm.devices.traits.Beta":        `{"label": "from beta"}`,
+		"sdm.devices.traits.Temperature": `{"ambientTemperatureCelsius": 20}`,
+	})
+
+	d, err := p.Parse(traits)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if d.CustomName != "from beta" {
+		t.Errorf("CustomName = %q, want the registered parser's", d.CustomName)
+	}
+	// Traits without a parser are kept, not parsed.
+	if d.Ambient != 0 {
+		t.Errorf("Ambient = %v, want 0 with no Temperature parser registered", d.Ambient)
+	}
+	if _, ok := d.Traits["sdm.devices.traits.Temperature"]; !ok {
+		t.Errorf("unparsed trait dropped from Traits")
+	}
+}
@@ -0,0 +1,51 @@
+package monitor
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information, set at link time:
+//
+//	go build -ldflags "-X thermostat/monitor.Version=v1.2.3 \
+//		-X thermostat/monitor.Commit=$(git rev-parse --short HEAD) \
+//		-X thermostat/monitor.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Commit and BuildTime fall back to the VCS details Go embeds in the binary.
+var (
+	Version   = "dev"
+	Commit    string
+	BuildTime string
+)
+
+func init() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	for _, s := range info.Settings {
+		switch {
+		case s.Key == "vcs.revision" && Commit == "":
+			Commit = s.Value
+			if len(Commit) > 7 {
+				Commit = Commit[:7]
+			}
+		case s.Key == "vcs.time" && BuildTime == "":
+			BuildTime = s.Value
+		}
+	}
+}
+
+// VersionString describes the running build, e.g.
+// "nest-thermostat-monitor v1.2.3 (commit: abc1234, built: 2024-01-15T10:00:00Z, go1.22.0)".
+func VersionString() string {
+	commit, built := Commit, BuildTime
+	if commit == "" {
+		commit = "unknown"
+	}
+	if built == "" {
+		built = "unknown"
+	}
+	return fmt.Sprintf("nest-thermostat-monitor %s (commit: %s, built: %s, %s)", Version, commit, built, runtime.Version())
+}
@@ -0,0 +1,94 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// watchdogRestartWait is how long the watchdog gives a cancelled cycle to
+// wind down before starting a new one.
+const watchdogRestartWait = 5 * time.Second
+
+// ErrWatchdogExpired is returned by Watchdog.Run when a restarted loop hangs
+// again. The process should exit with status 2.
+var ErrWatchdogExpired = errors.New("poll cycle hung twice in a row")
+
+// Watchdog restarts a long-running loop whose poll cycles stop completing,
+// e.g. because of a deadlock or an HTTP connection that ignores its context.
+type Watchdog struct {
+	m *Monitor
+
+	// lastPollCompletedAt is the time.Time the loop last finished a cycle.
+	lastPollCompletedAt atomic.Value
+}
+
+func newWatchdog(m *Monitor) *Watchdog {
+	w := &Watchdog{m: m}
+	w.lastPollCompletedAt.Store(time.Now())
+	return w
+}
+
+// Watchdog returns the monitor's watchdog.
+func (m *Monitor) Watchdog() *Watchdog {
+	return m.watchdog
+}
+
+// pollCompleted records that the loop finished a cycle.
+func (w *Watchdog) pollCompleted() {
+	w.lastPollCompletedAt.Store(time.Now())
+}
+
+// Run runs loop, checking every watchdog_timeout_seconds that it has
+// completed a poll cycle since the last check. If it hasn't, its context is
+// cancelled and, after watchdogRestartWait, loop is started again. If the
+// restarted loop hangs too, Run returns ErrWatchdogExpired. Otherwise it
+// returns loop's error. With watchdog_timeout_seconds unset, Run just runs
+// loop.
+func (w *Watchdog) Run(ctx context.Context, loop func(context.Context) error) error {
+	timeout := time.Duration(w.m.config().WatchdogTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		return loop(ctx)
+	}
+
+	start := func() (context.CancelFunc, <-chan error) {
+		w.pollCompleted()
+		loopCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() { done <- loop(loopCtx) }()
+		return cancel, done
+	}
+	cancel, done := start()
+	defer func() { cancel() }()
+
+	ticker := time.NewTicker(timeout)
+	defer ticker.Stop()
+	fired := false
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ticker.C:
+		}
+		last := w.lastPollCompletedAt.Load().(time.Time)
+		if time.Since(last) <= timeout {
+			fired = false
+			continue
+		}
+		if fired {
+			w.m.logger.Error("poll cycle hung again after restart, giving up", "last_completed", last)
+			return ErrWatchdogExpired
+		}
+		fired = true
+		w.m.logger.Error("poll cycle hung, restarting", "last_completed", last, "timeout", timeout)
+		cancel()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(watchdogRestartWait):
+		}
+		cancel, done = start()
+		ticker.Reset(timeout)
+	}
+}
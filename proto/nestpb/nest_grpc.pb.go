@@ -0,0 +1,268 @@
+// The monitor's gRPC API, for service-to-service consumers of thermostat
+// state and alerts. Regenerate the Go code in nestpb with:
+//
+//	protoc --go_out=. --go_opt=module=thermostat \
+//	    --go-grpc_out=. --go-grpc_opt=module=thermostat proto/nest.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: proto/nest.proto
+
+package nestpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	NestMonitor_GetDeviceStatus_FullMethodName     = "/nest.v1.NestMonitor/GetDeviceStatus"
+	NestMonitor_ListAlertHistory_FullMethodName    = "/nest.v1.NestMonitor/ListAlertHistory"
+	NestMonitor_TriggerAnomalyCheck_FullMethodName = "/nest.v1.NestMonitor/TriggerAnomalyCheck"
+	NestMonitor_StreamAlerts_FullMethodName        = "/nest.v1.NestMonitor/StreamAlerts"
+)
+
+// NestMonitorClient is the client API for NestMonitor service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type NestMonitorClient interface {
+	// GetDeviceStatus returns the device's latest stored state, as in /status.
+	GetDeviceStatus(ctx context.Context, in *GetDeviceStatusRequest, opts ...grpc.CallOption) (*DeviceStatus, error)
+	// ListAlertHistory returns the device's most recent alerts, newest first.
+	ListAlertHistory(ctx context.Context, in *ListAlertHistoryRequest, opts ...grpc.CallOption) (*ListAlertHistoryResponse, error)
+	// TriggerAnomalyCheck fetches the device now and runs it through the same
+	// checks as a poll, alerting as a poll would.
+	TriggerAnomalyCheck(ctx context.Context, in *TriggerAnomalyCheckRequest, opts ...grpc.CallOption) (*TriggerAnomalyCheckResponse, error)
+	// StreamAlerts sends each alert as it is raised until the client cancels.
+	StreamAlerts(ctx context.Context, in *StreamAlertsRequest, opts ...grpc.CallOption) (NestMonitor_StreamAlertsClient, error)
+}
+
+type nestMonitorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewNestMonitorClient(cc grpc.ClientConnInterface) NestMonitorClient {
+	return &nestMonitorClient{cc}
+}
+
+func (c *nestMonitorClient) GetDeviceStatus(ctx context.Context, in *GetDeviceStatusRequest, opts ...grpc.CallOption) (*DeviceStatus, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeviceStatus)
+	err := c.cc.Invoke(ctx, NestMonitor_GetDeviceStatus_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nestMonitorClient) ListAlertHistory(ctx context.Context, in *ListAlertHistoryRequest, opts ...grpc.CallOption) (*ListAlertHistoryResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListAlertHistoryResponse)
+	err := c.cc.Invoke(ctx, NestMonitor_ListAlertHistory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nestMonitorClient) TriggerAnomalyCheck(ctx context.Context, in *TriggerAnomalyCheckRequest, opts ...grpc.CallOption) (*TriggerAnomalyCheckResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TriggerAnomalyCheckResponse)
+	err := c.cc.Invoke(ctx, NestMonitor_TriggerAnomalyCheck_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *nestMonitorClient) StreamAlerts(ctx context.Context, in *StreamAlertsRequest, opts ...grpc.CallOption) (NestMonitor_StreamAlertsClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &NestMonitor_ServiceDesc.Streams[0], NestMonitor_StreamAlerts_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &nestMonitorStreamAlertsClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type NestMonitor_StreamAlertsClient interface {
+	Recv() (*AlertEvent, error)
+	grpc.ClientStream
+}
+
+type nestMonitorStreamAlertsClient struct {
+	grpc.ClientStream
+}
+
+func (x *nestMonitorStreamAlertsClient) Recv() (*AlertEvent, error) {
+	m := new(AlertEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// NestMonitorServer is the server API for NestMonitor service.
+// All implementations must embed UnimplementedNestMonitorServer
+// for forward compatibility
+type NestMonitorServer interface {
+	// GetDeviceStatus returns the device's latest stored state, as in /status.
+	GetDeviceStatus(context.Context, *GetDeviceStatusRequest) (*DeviceStatus, error)
+	// ListAlertHistory returns the device's most recent alerts, newest first.
+	ListAlertHistory(context.Context, *ListAlertHistoryRequest) (*ListAlertHistoryResponse, error)
+	// TriggerAnomalyCheck fetches the device now and runs it through the same
+	// checks as a poll, alerting as a poll would.
+	TriggerAnomalyCheck(context.Context, *TriggerAnomalyCheckRequest) (*TriggerAnomalyCheckResponse, error)
+	// StreamAlerts sends each alert as it is raised until the client cancels.
+	StreamAlerts(*StreamAlertsRequest, NestMonitor_StreamAlertsServer) error
+	mustEmbedUnimplementedNestMonitorServer()
+}
+
+// UnimplementedNestMonitorServer must be embedded to have forward compatible implementations.
+type UnimplementedNestMonitorServer struct {
+}
+
+func (UnimplementedNestMonitorServer) GetDeviceStatus(context.Context, *GetDeviceStatusRequest) (*DeviceStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDeviceStatus not implemented")
+}
+func (UnimplementedNestMonitorServer) ListAlertHistory(context.Context, *ListAlertHistoryRequest) (*ListAlertHistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAlertHistory not implemented")
+}
+func (UnimplementedNestMonitorServer) TriggerAnomalyCheck(context.Context, *TriggerAnomalyCheckRequest) (*TriggerAnomalyCheckResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TriggerAnomalyCheck not implemented")
+}
+func (UnimplementedNestMonitorServer) StreamAlerts(*StreamAlertsRequest, NestMonitor_StreamAlertsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamAlerts not implemented")
+}
+func (UnimplementedNestMonitorServer) mustEmbedUnimplementedNestMonitorServer() {}
+
+// UnsafeNestMonitorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to NestMonitorServer will
+// result in compilation errors.
+type UnsafeNestMonitorServer interface {
+	mustEmbedUnimplementedNestMonitorServer()
+}
+
+func RegisterNestMonitorServer(s grpc.ServiceRegistrar, srv NestMonitorServer) {
+	s.RegisterService(&NestMonitor_ServiceDesc, srv)
+}
+
+func _NestMonitor_GetDeviceStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDeviceStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NestMonitorServer).GetDeviceStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NestMonitor_GetDeviceStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NestMonitorServer).GetDeviceStatus(ctx, req.(*GetDeviceStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NestMonitor_ListAlertHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAlertHistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NestMonitorServer).ListAlertHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NestMonitor_ListAlertHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NestMonitorServer).ListAlertHistory(ctx, req.(*ListAlertHistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NestMonitor_TriggerAnomalyCheck_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TriggerAnomalyCheckRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(NestMonitorServer).TriggerAnomalyCheck(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: NestMonitor_TriggerAnomalyCheck_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(NestMonitorServer).TriggerAnomalyCheck(ctx, req.(*TriggerAnomalyCheckRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _NestMonitor_StreamAlerts_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamAlertsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(NestMonitorServer).StreamAlerts(m, &nestMonitorStreamAlertsServer{ServerStream: stream})
+}
+
+type NestMonitor_StreamAlertsServer interface {
+	Send(*AlertEvent) error
+	grpc.ServerStream
+}
+
+type nestMonitorStreamAlertsServer struct {
+	grpc.ServerStream
+}
+
+func (x *nestMonitorStreamAlertsServer) Send(m *AlertEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// NestMonitor_ServiceDesc is the grpc.ServiceDesc for NestMonitor service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var NestMonitor_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "nest.v1.NestMonitor",
+	HandlerType: (*NestMonitorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetDeviceStatus",
+			Handler:    _NestMonitor_GetDeviceStatus_Handler,
+		},
+		{
+			MethodName: "ListAlertHistory",
+			Handler:    _NestMonitor_ListAlertHistory_Handler,
+		},
+		{
+			MethodName: "TriggerAnomalyCheck",
+			Handler:    _NestMonitor_TriggerAnomalyCheck_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamAlerts",
+			Handler:       _NestMonitor_StreamAlerts_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/nest.proto",
+}